@@ -0,0 +1,3 @@
+module github.com/savvax/go-outline-lib-api
+
+go 1.21
@@ -0,0 +1,151 @@
+package outline_lib
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidAccessURL is returned when an ss:// access URL cannot be parsed
+var ErrInvalidAccessURL = errors.New("invalid access url")
+
+// SSConfig holds the Shadowsocks settings encoded in an access URL
+type SSConfig struct {
+	Method   string
+	Password string
+	Host     string
+	Port     int
+	Name     string
+}
+
+// ParseAccessURL parses the accessUrl of the key
+func (k AccessKey) ParseAccessURL() (SSConfig, error) {
+	return ParseAccessURL(k.AccessUrl)
+}
+
+// ParseAccessURL parses an ss:// URL in either the SIP002 format
+// (ss://base64(method:password)@host:port#name) or the legacy one (ss://base64(method:password@host:port)#name)
+func ParseAccessURL(accessURL string) (SSConfig, error) {
+	var cfg SSConfig
+
+	rest, ok := strings.CutPrefix(accessURL, "ss://")
+	if !ok {
+		return cfg, fmt.Errorf("%w: scheme must be ss://", ErrInvalidAccessURL)
+	}
+
+	rest, tag, _ := strings.Cut(rest, "#")
+	if tag != "" {
+		name, err := url.PathUnescape(tag)
+		if err != nil {
+			return cfg, fmt.Errorf("%w: bad name: %v", ErrInvalidAccessURL, err)
+		}
+		cfg.Name = name
+	}
+
+	var userInfo, hostPort string
+	if i := strings.LastIndex(rest, "@"); i >= 0 {
+		// SIP002: only the user info is encoded, it may be followed by a path and query
+		userInfo = rest[:i]
+		hostPort, _, _ = strings.Cut(rest[i+1:], "/")
+		hostPort, _, _ = strings.Cut(hostPort, "?")
+
+		if decoded, err := decodeBase64(userInfo); err == nil {
+			userInfo = decoded
+		} else if userInfo, err = url.PathUnescape(userInfo); err != nil {
+			return cfg, fmt.Errorf("%w: bad user info: %v", ErrInvalidAccessURL, err)
+		}
+	} else {
+		decoded, err := decodeBase64(rest)
+		if err != nil {
+			return cfg, fmt.Errorf("%w: %v", ErrInvalidAccessURL, err)
+		}
+		i := strings.LastIndex(decoded, "@")
+		if i < 0 {
+			return cfg, fmt.Errorf("%w: missing host", ErrInvalidAccessURL)
+		}
+		userInfo, hostPort = decoded[:i], decoded[i+1:]
+	}
+
+	method, password, ok := strings.Cut(userInfo, ":")
+	if !ok || method == "" || password == "" {
+		return cfg, fmt.Errorf("%w: user info must be method:password", ErrInvalidAccessURL)
+	}
+	cfg.Method, cfg.Password = method, password
+
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return cfg, fmt.Errorf("%w: %v", ErrInvalidAccessURL, err)
+	}
+	if host == "" {
+		return cfg, fmt.Errorf("%w: missing host", ErrInvalidAccessURL)
+	}
+	cfg.Host = host
+
+	cfg.Port, err = strconv.Atoi(port)
+	if err != nil || cfg.Port < 1 || cfg.Port > 65535 {
+		return cfg, fmt.Errorf("%w: bad port %q", ErrInvalidAccessURL, port)
+	}
+
+	return cfg, nil
+}
+
+// ValidateAccessURL checks that accessURL is an ss:// URL with method:password credentials
+// and a valid host and port, without contacting any server.
+// Failures wrap ErrInvalidAccessURL; the method is not checked against the ciphers Outline supports.
+func ValidateAccessURL(accessURL string) error {
+	cfg, err := ParseAccessURL(accessURL)
+	if err != nil {
+		return err
+	}
+	if err := validateHostname(cfg.Host); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidAccessURL, err)
+	}
+	return nil
+}
+
+// RewriteAccessURL replaces the host of an ss:// URL, keeping the credentials, port, query and name.
+// Legacy URLs are re-encoded with standard base64.
+func RewriteAccessURL(accessURL, newHost string) (string, error) {
+	cfg, err := ParseAccessURL(accessURL)
+	if err != nil {
+		return "", err
+	}
+	if err := validateHostname(newHost); err != nil {
+		return "", err
+	}
+	hostPort := net.JoinHostPort(newHost, strconv.Itoa(cfg.Port))
+
+	rest := strings.TrimPrefix(accessURL, "ss://")
+	rest, tag, hasTag := strings.Cut(rest, "#")
+	if hasTag {
+		tag = "#" + tag
+	}
+
+	i := strings.LastIndex(rest, "@")
+	if i < 0 {
+		legacy := cfg.Method + ":" + cfg.Password + "@" + hostPort
+		return "ss://" + base64.StdEncoding.EncodeToString([]byte(legacy)) + tag, nil
+	}
+
+	userInfo, after := rest[:i], rest[i+1:]
+	suffix := ""
+	if j := strings.IndexAny(after, "/?"); j >= 0 {
+		suffix = after[j:]
+	}
+	return "ss://" + userInfo + "@" + hostPort + suffix + tag, nil
+}
+
+// decodeBase64 accepts standard and URL-safe base64, with or without padding
+func decodeBase64(s string) (string, error) {
+	s = strings.TrimRight(s, "=")
+	if strings.ContainsAny(s, "-_") {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		return string(b), err
+	}
+	b, err := base64.RawStdEncoding.DecodeString(s)
+	return string(b), err
+}
@@ -0,0 +1,56 @@
+package outline_lib
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseAccessURL(t *testing.T) {
+	// base64 of "chacha20-ietf-poly1305:pass/word+1"
+	userInfo := "Y2hhY2hhMjAtaWV0Zi1wb2x5MTMwNTpwYXNzL3dvcmQrMQ"
+	tests := []struct {
+		name    string
+		url     string
+		want    SSConfig
+		wantErr bool
+	}{
+		{"SIP002", "ss://" + userInfo + "@vpn.example.com:8388/?outline=1#Office%20key",
+			SSConfig{Method: "chacha20-ietf-poly1305", Password: "pass/word+1", Host: "vpn.example.com", Port: 8388, Name: "Office key"}, false},
+		{"SIP002 padded", "ss://" + userInfo + "==@1.2.3.4:443",
+			SSConfig{Method: "chacha20-ietf-poly1305", Password: "pass/word+1", Host: "1.2.3.4", Port: 443}, false},
+		{"SIP002 URL-safe", "ss://YWVzLTI1Ni1nY206YT8-Pw@h:1",
+			SSConfig{Method: "aes-256-gcm", Password: "a?>?", Host: "h", Port: 1}, false},
+		{"SIP002 plain user info", "ss://aes-128-gcm:secret@h:2",
+			SSConfig{Method: "aes-128-gcm", Password: "secret", Host: "h", Port: 2}, false},
+		{"IPv6", "ss://" + userInfo + "@[2001:db8::1]:8388",
+			SSConfig{Method: "chacha20-ietf-poly1305", Password: "pass/word+1", Host: "2001:db8::1", Port: 8388}, false},
+		// base64 of "aes-256-gcm:p@ss@host.example:9000"
+		{"legacy", "ss://YWVzLTI1Ni1nY206cEBzc0Bob3N0LmV4YW1wbGU6OTAwMA==#legacy",
+			SSConfig{Method: "aes-256-gcm", Password: "p@ss", Host: "host.example", Port: 9000, Name: "legacy"}, false},
+
+		{"wrong scheme", "http://" + userInfo + "@h:1", SSConfig{}, true},
+		{"no password", "ss://YWVzLTI1Ni1nY20@h:1", SSConfig{}, true},
+		{"no port", "ss://" + userInfo + "@h", SSConfig{}, true},
+		{"port out of range", "ss://" + userInfo + "@h:65536", SSConfig{}, true},
+		{"no host", "ss://" + userInfo + "@:1", SSConfig{}, true},
+		{"legacy without host", "ss://YWVzLTI1Ni1nY206cGFzcw", SSConfig{}, true},
+		{"bad name", "ss://" + userInfo + "@h:1#%zz", SSConfig{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseAccessURL(tt.url)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidAccessURL) {
+				t.Errorf("%s: got %v, want ErrInvalidAccessURL", tt.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
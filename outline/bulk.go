@@ -0,0 +1,172 @@
+package outline_lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// defaultBulkWorkers is the number of concurrent requests used by bulk operations
+// when Client.BulkWorkers is not set
+const defaultBulkWorkers = 8
+
+// BulkResult reports the outcome of an operation applied to several access keys
+type BulkResult struct {
+	Succeeded []string
+	Failed    []BulkFailure
+}
+
+// BulkFailure is an access key id the operation failed for
+type BulkFailure struct {
+	Id  string
+	Err error
+}
+
+// Err joins the errors of all failed ids, or returns nil if there were none
+func (r BulkResult) Err() error {
+	errs := make([]error, 0, len(r.Failed))
+	for _, failure := range r.Failed {
+		errs = append(errs, fmt.Errorf("access key %s: %w", failure.Id, failure.Err))
+	}
+	return errors.Join(errs...)
+}
+
+// DeleteAccessKeys deletes every key in ids, continuing after individual failures
+func (c *Client) DeleteAccessKeys(ids []string) (BulkResult, error) {
+	return c.DeleteAccessKeysCtx(context.Background(), ids)
+}
+
+// DeleteAccessKeysCtx deletes every key in ids, continuing after individual failures.
+// The returned error is only set when ctx is done before all keys were processed.
+func (c *Client) DeleteAccessKeysCtx(ctx context.Context, ids []string) (BulkResult, error) {
+	return c.runBulk(ctx, ids, func(ctx context.Context, id string) error {
+		_, err := c.DeleteAccessKeyCtx(ctx, id)
+		return err
+	})
+}
+
+// SetDataLimitForKeys sets the same data limit on every key in ids, continuing after individual failures
+func (c *Client) SetDataLimitForKeys(ids []string, bytes int64) (BulkResult, error) {
+	return c.SetDataLimitForKeysCtx(context.Background(), ids, bytes)
+}
+
+// SetDataLimitForKeysCtx sets the same data limit on every key in ids, continuing after individual failures.
+// The returned error is only set when ctx is done before all keys were processed.
+func (c *Client) SetDataLimitForKeysCtx(ctx context.Context, ids []string, bytes int64) (BulkResult, error) {
+	return c.runBulk(ctx, ids, func(ctx context.Context, id string) error {
+		_, err := c.SetDataLimitAccessKeyByIDCtx(ctx, id, bytes)
+		return err
+	})
+}
+
+// ApplyDefaultLimitToUnlimitedKeys sets the data limit on every key without a limit of its own,
+// continuing after individual failures
+func (c *Client) ApplyDefaultLimitToUnlimitedKeys(bytes int64) (BulkResult, error) {
+	return c.ApplyDefaultLimitToUnlimitedKeysCtx(context.Background(), bytes)
+}
+
+// ApplyDefaultLimitToUnlimitedKeysCtx sets the data limit on every key without a limit of its own,
+// continuing after individual failures.
+// The returned error is set when the keys cannot be listed or ctx is done before all keys were processed.
+func (c *Client) ApplyDefaultLimitToUnlimitedKeysCtx(ctx context.Context, bytes int64) (BulkResult, error) {
+	accessKeysResponse, err := c.GetListAccessKeysCtx(ctx)
+	if err != nil {
+		return BulkResult{}, err
+	}
+
+	var ids []string
+	for _, key := range withoutOwnLimit(accessKeysResponse.AccessKeys) {
+		ids = append(ids, key.Id)
+	}
+	return c.SetDataLimitForKeysCtx(ctx, ids, bytes)
+}
+
+// RenameAccessKeys renames every key in names, which maps ids to new names, continuing after individual failures
+func (c *Client) RenameAccessKeys(names map[string]string) (BulkResult, error) {
+	return c.RenameAccessKeysCtx(context.Background(), names)
+}
+
+// RenameAccessKeysCtx renames every key in names, which maps ids to new names, continuing after individual failures.
+// The returned error is only set when ctx is done before all keys were processed.
+func (c *Client) RenameAccessKeysCtx(ctx context.Context, names map[string]string) (BulkResult, error) {
+	ids := make([]string, 0, len(names))
+	for id := range names {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return c.runBulk(ctx, ids, func(ctx context.Context, id string) error {
+		if _, err := c.sendPutRequest(ctx, accessKeyPath(id)+"/name", map[string]string{"name": names[id]}); err != nil {
+			return wrapKeyNotFound(err)
+		}
+		// Unlike RenameAccessKeyByID, keys missing from the cache are not fetched one by one
+		if key, ok := c.cachedAccessKey(id); ok {
+			key.Name = names[id]
+			c.updateCachedAccessKey(key)
+		}
+		return nil
+	})
+}
+
+// runBulk calls fn for every id using a bounded pool of workers.
+// Ids that were not started before ctx was done are reported neither as succeeded nor failed.
+func (c *Client) runBulk(ctx context.Context, ids []string, fn func(ctx context.Context, id string) error) (BulkResult, error) {
+	errs, started := c.runConcurrently(ctx, len(ids), func(ctx context.Context, i int) error {
+		return fn(ctx, ids[i])
+	})
+
+	var result BulkResult
+	for i, id := range ids {
+		switch {
+		case !started[i]:
+		case errs[i] != nil:
+			result.Failed = append(result.Failed, BulkFailure{Id: id, Err: errs[i]})
+		default:
+			result.Succeeded = append(result.Succeeded, id)
+		}
+	}
+	return result, ctx.Err()
+}
+
+// runConcurrently calls fn for every index in [0, n) using Client.BulkWorkers workers,
+// and stops starting new calls once ctx is done
+func (c *Client) runConcurrently(ctx context.Context, n int, fn func(ctx context.Context, i int) error) (errs []error, started []bool) {
+	workers := c.BulkWorkers
+	if workers <= 0 {
+		workers = defaultBulkWorkers
+	}
+	if workers > n {
+		workers = n
+	}
+
+	errs = make([]error, n)
+	started = make([]bool, n)
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				errs[i] = fn(ctx, i)
+			}
+		}()
+	}
+
+feed:
+	for i := 0; i < n; i++ {
+		select {
+		case <-ctx.Done():
+			break feed
+		case jobs <- i:
+			started[i] = true
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return errs, started
+}
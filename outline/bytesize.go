@@ -0,0 +1,88 @@
+package outline_lib
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidByteSize is returned by ParseBytes for malformed sizes
+var ErrInvalidByteSize = errors.New("invalid byte size")
+
+var (
+	decimalUnits = []string{"B", "KB", "MB", "GB", "TB", "PB", "EB"}
+	binaryUnits  = []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+)
+
+// byteMultipliers maps lowercase unit suffixes accepted by ParseBytes to their size
+var byteMultipliers = map[string]float64{
+	"":    1,
+	"b":   1,
+	"kb":  1e3,
+	"mb":  1e6,
+	"gb":  1e9,
+	"tb":  1e12,
+	"pb":  1e15,
+	"eb":  1e18,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+	"pib": 1 << 50,
+	"eib": 1 << 60,
+}
+
+// FormatBytes formats n with one decimal, e.g. "1.4 GB", using powers of 1024 (GiB) when binary is set
+// and powers of 1000 (GB) otherwise
+func FormatBytes(n int64, binary bool) string {
+	base, units := 1000.0, decimalUnits
+	if binary {
+		base, units = 1024.0, binaryUnits
+	}
+
+	value := math.Abs(float64(n))
+	if value < base {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	exp := 0
+	for value >= base && exp < len(units)-1 {
+		value /= base
+		exp++
+	}
+	if n < 0 {
+		value = -value
+	}
+	return fmt.Sprintf("%.1f %s", value, units[exp])
+}
+
+// ParseBytes parses sizes such as "500MB", "1.5 GiB" or "1024". Units are case-insensitive;
+// KB, MB, GB... are powers of 1000 and KiB, MiB, GiB... are powers of 1024.
+func ParseBytes(s string) (int64, error) {
+	trimmed := strings.TrimSpace(s)
+	i := strings.IndexFunc(trimmed, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i < 0 {
+		i = len(trimmed)
+	}
+
+	number, unit := trimmed[:i], strings.ToLower(strings.TrimSpace(trimmed[i:]))
+	multiplier, ok := byteMultipliers[unit]
+	if !ok {
+		return 0, fmt.Errorf("%w: unknown unit in %q", ErrInvalidByteSize, s)
+	}
+
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidByteSize, s)
+	}
+
+	bytes := math.Round(value * multiplier)
+	if bytes >= math.MaxInt64 {
+		return 0, fmt.Errorf("%w: %q is too large", ErrInvalidByteSize, s)
+	}
+	return int64(bytes), nil
+}
@@ -0,0 +1,82 @@
+package outline_lib
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseBytes(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"1024", 1024, false},
+		{"0", 0, false},
+		{"500MB", 500e6, false},
+		{"1.5 GiB", 3 << 29, false},
+		{" 2 kb ", 2000, false},
+		{"1KIB", 1024, false},
+		{"10B", 10, false},
+		{"1 TB", 1e12, false},
+		{"2PiB", 2 << 50, false},
+		{"7EiB", 7 << 60, false},
+		{"9EB", 9e18, false},
+
+		{"", 0, true},
+		{"GB", 0, true},
+		{"1.2.3 MB", 0, true},
+		{"5 XB", 0, true},
+		{"-5MB", 0, true},
+		{"8EiB", 0, true},
+		{"10EB", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseBytes(tt.in)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidByteSize) {
+				t.Errorf("ParseBytes(%q): got %d, %v, want ErrInvalidByteSize", tt.in, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseBytes(%q): got %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n      int64
+		binary bool
+		want   string
+	}{
+		{0, false, "0 B"},
+		{999, false, "999 B"},
+		{1023, true, "1023 B"},
+		{1500, false, "1.5 KB"},
+		{1536, true, "1.5 KiB"},
+		{1.4e9, false, "1.4 GB"},
+		{-2500, false, "-2.5 KB"},
+		{9e18, false, "9.0 EB"},
+		{7 << 60, true, "7.0 EiB"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatBytes(tt.n, tt.binary); got != tt.want {
+			t.Errorf("FormatBytes(%d, %v): got %q, want %q", tt.n, tt.binary, got, tt.want)
+		}
+	}
+}
+
+func TestFormatBytesRoundTrip(t *testing.T) {
+	for _, n := range []int64{1, 1000, 1 << 20, 5e9, 3 << 40, 2e15, 1 << 60} {
+		for _, binary := range []bool{false, true} {
+			s := FormatBytes(n, binary)
+			if _, err := ParseBytes(s); err != nil {
+				t.Errorf("ParseBytes(FormatBytes(%d, %v) = %q): %v", n, binary, s, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package outline_lib
+
+// Field names reported in AccessKeyChange.Fields
+const (
+	FieldName      = "name"
+	FieldPort      = "port"
+	FieldMethod    = "method"
+	FieldDataLimit = "dataLimit"
+)
+
+// AccessKeyDiff is the difference between two lists of access keys
+type AccessKeyDiff struct {
+	Added    []AccessKey
+	Removed  []AccessKey
+	Modified []AccessKeyChange
+}
+
+// AccessKeyChange is a key present in both lists with different settings
+type AccessKeyChange struct {
+	Id     string
+	Old    AccessKey
+	New    AccessKey
+	Fields []string // FieldName, FieldPort, FieldMethod or FieldDataLimit
+}
+
+// Empty reports whether the two lists hold the same keys with the same settings
+func (d AccessKeyDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Modified) == 0
+}
+
+// DiffAccessKeys compares two fetches of the key list by id.
+// Added and Modified follow the order of new, Removed the order of old.
+func DiffAccessKeys(old, new []AccessKey) AccessKeyDiff {
+	oldByID := make(map[string]int, len(old))
+	for i, key := range old {
+		oldByID[key.Id] = i
+	}
+
+	var diff AccessKeyDiff
+	seen := make([]bool, len(old))
+	for _, key := range new {
+		i, ok := oldByID[key.Id]
+		if !ok {
+			diff.Added = append(diff.Added, key)
+			continue
+		}
+		seen[i] = true
+		if fields := changedFields(old[i], key); len(fields) != 0 {
+			diff.Modified = append(diff.Modified, AccessKeyChange{Id: key.Id, Old: old[i], New: key, Fields: fields})
+		}
+	}
+	for i, key := range old {
+		if !seen[i] {
+			diff.Removed = append(diff.Removed, key)
+		}
+	}
+	return diff
+}
+
+func changedFields(old, new AccessKey) []string {
+	var fields []string
+	if old.Name != new.Name {
+		fields = append(fields, FieldName)
+	}
+	if old.Port != new.Port {
+		fields = append(fields, FieldPort)
+	}
+	if old.Method != new.Method {
+		fields = append(fields, FieldMethod)
+	}
+	if !sameDataLimit(old.DataLimit, new.DataLimit) {
+		fields = append(fields, FieldDataLimit)
+	}
+	return fields
+}
+
+func sameDataLimit(a, b *DataLimit) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Bytes == b.Bytes
+}
@@ -0,0 +1,150 @@
+package outline_lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+)
+
+// ErrCertificateMismatch is returned when the server certificate does not match the pinned fingerprint
+var ErrCertificateMismatch = errors.New("server certificate does not match certSha256")
+
+// ErrInvalidCertSha256 is returned when a certSha256 fingerprint is not 64 hex digits
+var ErrInvalidCertSha256 = errors.New("invalid certSha256")
+
+// ErrUnsupportedMethod is returned when a cipher method is not accepted by the Outline server
+var ErrUnsupportedMethod = errors.New("unsupported cipher method")
+
+// ErrKeyNotFound is returned when the requested access key does not exist
+var ErrKeyNotFound = errors.New("access key not found")
+
+// ErrPortConflict is returned when the server reports that a port is already in use
+var ErrPortConflict = errors.New("port already in use")
+
+// ErrNotSupported is returned when the server does not implement the requested endpoint
+var ErrNotSupported = errors.New("not supported by the server")
+
+// ErrTimeout is returned when a request did not complete before its deadline
+var ErrTimeout = errors.New("request timed out")
+
+// ErrCanceled is returned when the context of a request was canceled
+var ErrCanceled = errors.New("request canceled")
+
+// TLSHandshakeError is returned when the TLS handshake with the server fails or exceeds the
+// handshake timeout, as opposed to the request failing once connected. Err keeps the cause, so
+// errors.Is(err, ErrTimeout) and errors.Is(err, ErrCertificateMismatch) still work.
+type TLSHandshakeError struct {
+	Err error
+}
+
+func (e *TLSHandshakeError) Error() string {
+	return "tls handshake failed: " + e.Err.Error()
+}
+
+func (e *TLSHandshakeError) Unwrap() error {
+	return e.Err
+}
+
+// UnsupportedVersionError is returned when the server version is known to be too old for Feature,
+// before any request to its endpoint is sent. It matches ErrNotSupported with errors.Is.
+type UnsupportedVersionError struct {
+	Feature  Feature
+	Required SemVer
+	Actual   SemVer
+}
+
+func (e *UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("%v: %s requires server version %s, server runs %s", ErrNotSupported, e.Feature, e.Required, e.Actual)
+}
+
+func (e *UnsupportedVersionError) Unwrap() error {
+	return ErrNotSupported
+}
+
+// maxErrorBodySize limits how much of an error response is kept in APIError.Body
+const maxErrorBodySize = 64 << 10
+
+// APIError is returned by MakeRequest when the server responds with a 4xx or 5xx status.
+// Code and Message are filled from the JSON error body sent by the Outline server, if any.
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+	Body       []byte
+}
+
+func (e *APIError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("server responded with code %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("server responded with code %d", e.StatusCode)
+}
+
+func newAPIError(resp *http.Response) *APIError {
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	if err != nil || len(body) == 0 {
+		return apiErr
+	}
+	apiErr.Body = body
+
+	var payload struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &payload) == nil {
+		apiErr.Code = payload.Code
+		apiErr.Message = payload.Message
+	}
+	return apiErr
+}
+
+// wrapKeyNotFound marks a 404 response for an access key endpoint with ErrKeyNotFound,
+// keeping the APIError available through errors.As
+func wrapKeyNotFound(err error) error {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %w", ErrKeyNotFound, err)
+	}
+	return err
+}
+
+// wrapPortConflict marks a 409 response to a port change with ErrPortConflict
+func wrapPortConflict(err error) error {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict {
+		return fmt.Errorf("%w: %w", ErrPortConflict, err)
+	}
+	return err
+}
+
+// wrapNotSupported marks a 404, 405 or 501 response with ErrNotSupported
+func wrapNotSupported(err error) error {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	switch apiErr.StatusCode {
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return fmt.Errorf("%w: %w", ErrNotSupported, err)
+	}
+	return err
+}
+
+// wrapContextError marks errors caused by an expired deadline with ErrTimeout
+// and by a canceled context with ErrCanceled
+func wrapContextError(err error) error {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		return fmt.Errorf("%w: %w", ErrCanceled, err)
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	return err
+}
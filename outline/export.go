@@ -0,0 +1,122 @@
+package outline_lib
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+)
+
+// ExportFormat selects the document produced by ExportAccessKeys
+type ExportFormat int
+
+const (
+	// ExportAccessURLs is a JSON array of ss:// access URLs
+	ExportAccessURLs ExportFormat = iota
+	// ExportSIP008 is a SIP008 online config document
+	ExportSIP008
+)
+
+// SIP008Config is a SIP008 online config document
+type SIP008Config struct {
+	Version int            `json:"version"`
+	Servers []SIP008Server `json:"servers"`
+}
+
+type SIP008Server struct {
+	Id         string `json:"id"`
+	Remarks    string `json:"remarks"`
+	Server     string `json:"server"`
+	ServerPort int    `json:"server_port"`
+	Password   string `json:"password"`
+	Method     string `json:"method"`
+}
+
+// ExportAccessKeys returns all access keys in the given format
+func (c *Client) ExportAccessKeys(format ExportFormat) ([]byte, error) {
+	return c.ExportAccessKeysCtx(context.Background(), format)
+}
+
+func (c *Client) ExportAccessKeysCtx(ctx context.Context, format ExportFormat) ([]byte, error) {
+	switch format {
+	case ExportAccessURLs:
+		accessKeysResponse, err := c.GetListAccessKeysCtx(ctx)
+		if err != nil {
+			return nil, err
+		}
+		urls := make([]string, 0, len(accessKeysResponse.AccessKeys))
+		for _, key := range accessKeysResponse.AccessKeys {
+			urls = append(urls, key.AccessUrl)
+		}
+		return json.Marshal(urls)
+	case ExportSIP008:
+		return c.BuildSIP008(ctx)
+	}
+	return nil, fmt.Errorf("unknown export format %d", format)
+}
+
+// BuildSIP008 returns a SIP008 online config document with one server entry per access key.
+// The connection settings are taken from each key's accessUrl.
+func (c *Client) BuildSIP008(ctx context.Context) ([]byte, error) {
+	accessKeysResponse, err := c.GetListAccessKeysCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := c.sip008Config(ctx, accessKeysResponse.AccessKeys)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(config, "", "  ")
+}
+
+func (c *Client) sip008Config(ctx context.Context, keys []AccessKey) (SIP008Config, error) {
+	config := SIP008Config{Version: 1, Servers: make([]SIP008Server, 0, len(keys))}
+	for _, key := range keys {
+		ss, err := c.ssConfig(ctx, key)
+		if err != nil {
+			return config, fmt.Errorf("access key %s: %w", key.Id, err)
+		}
+		config.Servers = append(config.Servers, SIP008Server{
+			Id:         c.sip008ID(key.Id),
+			Remarks:    key.Name,
+			Server:     ss.Host,
+			ServerPort: ss.Port,
+			Password:   ss.Password,
+			Method:     ss.Method,
+		})
+	}
+	return config, nil
+}
+
+// ssConfig returns the connection settings of a key from its accessUrl, or from
+// the key fields and the server hostname when the accessUrl is missing
+func (c *Client) ssConfig(ctx context.Context, key AccessKey) (SSConfig, error) {
+	if key.AccessUrl != "" {
+		return key.ParseAccessURL()
+	}
+
+	serverInfo, ok := c.CachedServerInfo()
+	if !ok {
+		var err error
+		if serverInfo, err = c.GetServerInfoCtx(ctx); err != nil {
+			return SSConfig{}, err
+		}
+	}
+	return SSConfig{
+		Method:   key.Method,
+		Password: key.Password,
+		Host:     serverInfo.HostnameForAccessKeys,
+		Port:     key.Port,
+		Name:     key.Name,
+	}, nil
+}
+
+// sip008ID derives a stable UUID (version 5 layout) from the API URL and the key id,
+// so clients recognize the same server across subscription updates
+func (c *Client) sip008ID(keyID string) string {
+	sum := sha1.Sum([]byte(c.ApiUrl + "/access-keys/" + keyID))
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
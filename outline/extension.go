@@ -1,83 +1,433 @@
 package outline_lib
 
-func (c *Client) GetAccessKeyByID(id string) (result AccessKey, err error) {
-	if len(c.accessKeysCache) == 0 {
-		accessKeysResponse, err := c.GetListAccessKeys()
-		if err != nil {
-			return result, err
-		}
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// InvalidateCache clears the cached access keys, transfer metrics and server info,
+// so the next cache-backed call reloads them from the server
+func (c *Client) InvalidateCache() {
+	c.cacheMu.Lock()
+	c.accessKeysCache = nil
+	c.transferredDataCache = nil
+	c.serverInfoCache = nil
+	c.cacheGen++
+	c.cacheMu.Unlock()
+}
+
+// CachedServerInfo returns the result of the last successful GetServerInfo call,
+// or false if there was none since the server settings last changed
+func (c *Client) CachedServerInfo() (ServerResponse, bool) {
+	c.cacheMu.RLock()
+	defer c.cacheMu.RUnlock()
+	if c.serverInfoCache == nil {
+		return ServerResponse{}, false
+	}
+	return *c.serverInfoCache, true
+}
+
+func (c *Client) invalidateServerInfoCache() {
+	c.cacheMu.Lock()
+	c.serverInfoCache = nil
+	c.cacheMu.Unlock()
+}
+
+// RefreshCache reloads the cached access keys and transfer metrics from the server
+func (c *Client) RefreshCache(ctx context.Context) error {
+	gen := c.cacheGeneration()
+	accessKeysResponse, err := c.GetListAccessKeysCtx(ctx)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.DataTransferredAccessKeyCtx(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.cacheMu.Lock()
+	if c.cacheGen == gen {
 		c.accessKeysCache = accessKeysResponse.AccessKeys
+		c.transferredDataCache = resp.BytesTransferredByUserId
+		c.cacheGen++
 	}
+	c.cacheMu.Unlock()
+	return nil
+}
+
+// cacheGeneration returns the current cacheGen; a load may only store its result
+// if cacheGen is unchanged by the time it completes
+func (c *Client) cacheGeneration() uint64 {
+	c.cacheMu.RLock()
+	defer c.cacheMu.RUnlock()
+	return c.cacheGen
+}
+
+func (c *Client) recordKeyCreation(id string) {
+	c.setKeyCreation(id, time.Now())
+}
+
+func (c *Client) setKeyCreation(id string, createdAt time.Time) {
+	c.cacheMu.Lock()
+	if c.createdKeys == nil {
+		c.createdKeys = make(map[string]time.Time)
+	}
+	c.createdKeys[id] = createdAt
+	c.cacheMu.Unlock()
+}
+
+// forgetKeyCreation drops the creation time of a deleted key, so createdKeys does not grow
+// with every key ever created and a reused id does not inherit it
+func (c *Client) forgetKeyCreation(id string) {
+	c.cacheMu.Lock()
+	delete(c.createdKeys, id)
+	c.cacheMu.Unlock()
+}
+
+// keyCreatedAt returns when this Client created the key, if it did
+func (c *Client) keyCreatedAt(id string) (time.Time, bool) {
+	c.cacheMu.RLock()
+	defer c.cacheMu.RUnlock()
+	createdAt, ok := c.createdKeys[id]
+	return createdAt, ok
+}
+
+// cachedAccessKey returns a key from the cache without loading it from the server
+func (c *Client) cachedAccessKey(id string) (AccessKey, bool) {
+	c.cacheMu.RLock()
+	defer c.cacheMu.RUnlock()
 	for _, key := range c.accessKeysCache {
 		if key.Id == id {
-			return key, nil
+			return key, true
 		}
 	}
-	return
+	return AccessKey{}, false
 }
 
-func (c *Client) CheckAccessKeyByID(id string) (result bool, err error) {
-	if len(c.accessKeysCache) == 0 {
-		accessKeysResponse, err := c.GetListAccessKeys()
-		if err != nil {
-			return false, err
+// updateCachedAccessKey replaces a cached key with a copy of the cache holding the new value.
+// Loads already running are outdated by the change even if the key is not cached.
+func (c *Client) updateCachedAccessKey(updated AccessKey) {
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+	c.cacheGen++
+	for i, key := range c.accessKeysCache {
+		if key.Id == updated.Id {
+			accessKeys := make([]AccessKey, len(c.accessKeysCache))
+			copy(accessKeys, c.accessKeysCache)
+			accessKeys[i] = updated
+			c.accessKeysCache = accessKeys
+			return
 		}
+	}
+}
+
+// RefreshAccessURLs reloads the access keys, e.g. after ChangeHostname, so their accessUrl
+// values carry the new hostname, and replaces the cached keys with them
+func (c *Client) RefreshAccessURLs() ([]AccessKey, error) {
+	return c.RefreshAccessURLsCtx(context.Background())
+}
+
+func (c *Client) RefreshAccessURLsCtx(ctx context.Context) ([]AccessKey, error) {
+	gen := c.cacheGeneration()
+	accessKeysResponse, err := c.GetListAccessKeysCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.cacheMu.Lock()
+	if c.cacheGen == gen {
 		c.accessKeysCache = accessKeysResponse.AccessKeys
+		c.cacheGen++
 	}
-	for _, key := range c.accessKeysCache {
+	c.cacheMu.Unlock()
+	return accessKeysResponse.AccessKeys, nil
+}
+
+func (c *Client) invalidateAccessKeysCache() {
+	c.cacheMu.Lock()
+	c.accessKeysCache = nil
+	c.cacheGen++
+	c.cacheMu.Unlock()
+}
+
+func (c *Client) invalidateTransferredDataCache() {
+	c.cacheMu.Lock()
+	c.transferredDataCache = nil
+	c.cacheGen++
+	c.cacheMu.Unlock()
+}
+
+// cachedAccessKeys returns the cached access keys, loading them from the server on first use
+func (c *Client) cachedAccessKeys(ctx context.Context) ([]AccessKey, error) {
+	c.cacheMu.RLock()
+	keys, gen := c.accessKeysCache, c.cacheGen
+	c.cacheMu.RUnlock()
+	if len(keys) != 0 {
+		return keys, nil
+	}
+
+	// Concurrent callers on a cold cache share a single list request; callers arriving after
+	// an invalidation start a new one rather than sharing a load that is already outdated
+	v, err := c.cacheFills.do(ctx, "access-keys/"+strconv.FormatUint(gen, 10), func(ctx context.Context) (any, error) {
+		accessKeysResponse, err := c.GetListAccessKeysCtx(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		c.cacheMu.Lock()
+		if c.cacheGen == gen {
+			c.accessKeysCache = accessKeysResponse.AccessKeys
+		}
+		c.cacheMu.Unlock()
+		return accessKeysResponse.AccessKeys, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]AccessKey), nil
+}
+
+// cachedTransferredData returns the cached transfer metrics, loading them from the server on first use
+func (c *Client) cachedTransferredData(ctx context.Context) (map[string]int64, error) {
+	c.cacheMu.RLock()
+	data, gen := c.transferredDataCache, c.cacheGen
+	c.cacheMu.RUnlock()
+	if data != nil {
+		return data, nil
+	}
+
+	v, err := c.cacheFills.do(ctx, "transferred-data/"+strconv.FormatUint(gen, 10), func(ctx context.Context) (any, error) {
+		resp, err := c.DataTransferredAccessKeyCtx(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		c.cacheMu.Lock()
+		if c.cacheGen == gen {
+			c.transferredDataCache = resp.BytesTransferredByUserId
+		}
+		c.cacheMu.Unlock()
+		return resp.BytesTransferredByUserId, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(map[string]int64), nil
+}
+
+// GetAccessKeyByID looks the key up in the cache and returns ErrKeyNotFound if it is not there
+func (c *Client) GetAccessKeyByID(id string) (result AccessKey, err error) {
+	return c.GetAccessKeyByIDCtx(context.Background(), id)
+}
+
+func (c *Client) GetAccessKeyByIDCtx(ctx context.Context, id string) (result AccessKey, err error) {
+	accessKeys, err := c.cachedAccessKeys(ctx)
+	if err != nil {
+		return result, err
+	}
+	for _, key := range accessKeys {
+		if key.Id == id {
+			return key, nil
+		}
+	}
+	return result, ErrKeyNotFound
+}
+
+// CheckAccessKeyByID looks the key up in the cache and returns false with ErrKeyNotFound if it is not there
+func (c *Client) CheckAccessKeyByID(id string) (result bool, err error) {
+	return c.CheckAccessKeyByIDCtx(context.Background(), id)
+}
+
+func (c *Client) CheckAccessKeyByIDCtx(ctx context.Context, id string) (result bool, err error) {
+	accessKeys, err := c.cachedAccessKeys(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, key := range accessKeys {
 		if key.Id == id {
 			return true, nil
 		}
 	}
-	return
+	return false, ErrKeyNotFound
+}
+
+// GetDataLimit returns the data limit of a single key in bytes and whether one is set
+func (c *Client) GetDataLimit(id string) (int64, bool, error) {
+	return c.GetDataLimitCtx(context.Background(), id)
+}
+
+func (c *Client) GetDataLimitCtx(ctx context.Context, id string) (int64, bool, error) {
+	key, err := c.GetAccessKeyByIDCtx(ctx, id)
+	if err != nil {
+		return 0, false, err
+	}
+	if key.DataLimit == nil {
+		return 0, false, nil
+	}
+	return key.DataLimit.Bytes, true, nil
 }
 
 func (c *Client) GetNumberOfUsers() (int, error) {
-	if len(c.accessKeysCache) == 0 {
-		accessKeysResponse, err := c.GetListAccessKeys()
-		if err != nil {
-			return 0, err
-		}
-		c.accessKeysCache = accessKeysResponse.AccessKeys
+	return c.GetNumberOfUsersCtx(context.Background())
+}
+
+func (c *Client) GetNumberOfUsersCtx(ctx context.Context) (int, error) {
+	accessKeys, err := c.cachedAccessKeys(ctx)
+	if err != nil {
+		return 0, err
 	}
-	return len(c.accessKeysCache), nil
+	return len(accessKeys), nil
 }
 
 func (c *Client) GetNumberOfActiveUsers() (int, error) {
-	if c.transferredDataCache == nil {
-		resp, err := c.DataTransferredAccessKey()
-		if err != nil {
-			return 0, err
+	return c.GetNumberOfActiveUsersCtx(context.Background())
+}
+
+func (c *Client) GetNumberOfActiveUsersCtx(ctx context.Context) (int, error) {
+	transferredData, err := c.cachedTransferredData(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return len(transferredData), nil
+}
+
+// GetTransferredDataByKeyID returns the bytes transferred by a single key and whether
+// the key appears in the transfer metrics at all; keys without traffic are absent from them
+func (c *Client) GetTransferredDataByKeyID(id string) (int64, bool, error) {
+	return c.GetTransferredDataByKeyIDCtx(context.Background(), id)
+}
+
+func (c *Client) GetTransferredDataByKeyIDCtx(ctx context.Context, id string) (int64, bool, error) {
+	transferredData, err := c.cachedTransferredData(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	bytes, ok := transferredData[id]
+	return bytes, ok, nil
+}
+
+// GetNumberOfActiveUsersAbove returns the number of keys that transferred more than minBytes,
+// which ignores keys with only handshake traffic
+func (c *Client) GetNumberOfActiveUsersAbove(minBytes int64) (int, error) {
+	return c.GetNumberOfActiveUsersAboveCtx(context.Background(), minBytes)
+}
+
+func (c *Client) GetNumberOfActiveUsersAboveCtx(ctx context.Context, minBytes int64) (int, error) {
+	transferredData, err := c.cachedTransferredData(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, bytes := range transferredData {
+		if bytes > minBytes {
+			count++
 		}
-		c.transferredDataCache = resp.BytesTransferredByUserId
 	}
-	return len(c.transferredDataCache), nil
+	return count, nil
 }
 
-func (c *Client) DeleteAllKeysWithOutTraffic() (result bool, err error) {
-	if c.transferredDataCache == nil {
-		resp, err := c.DataTransferredAccessKey()
-		if err != nil {
-			return false, err
+// GetNumberOfInactiveUsers returns the number of keys without transferred data,
+// i.e. the keys DeleteAllKeysWithOutTraffic would delete
+func (c *Client) GetNumberOfInactiveUsers() (int, error) {
+	return c.GetNumberOfInactiveUsersCtx(context.Background())
+}
+
+func (c *Client) GetNumberOfInactiveUsersCtx(ctx context.Context) (int, error) {
+	accessKeys, err := c.ListKeysWithoutTrafficCtx(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return len(accessKeys), nil
+}
+
+// ListKeysWithoutTraffic returns the keys DeleteAllKeysWithOutTraffic would delete,
+// i.e. the keys that have no entry in the transfer metrics
+func (c *Client) ListKeysWithoutTraffic() ([]AccessKey, error) {
+	return c.ListKeysWithoutTrafficCtx(context.Background())
+}
+
+func (c *Client) ListKeysWithoutTrafficCtx(ctx context.Context) ([]AccessKey, error) {
+	transferredData, err := c.cachedTransferredData(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	accessKeys, err := c.cachedAccessKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []AccessKey
+	for _, accessKey := range accessKeys {
+		if _, ok := transferredData[accessKey.Id]; !ok {
+			result = append(result, accessKey)
 		}
-		c.transferredDataCache = resp.BytesTransferredByUserId
 	}
+	return result, nil
+}
 
-	if len(c.accessKeysCache) == 0 {
-		accessKeysResponse, err := c.GetListAccessKeys()
-		if err != nil {
-			return false, err
+// ListAccessKeysCreatedAfter returns the existing keys this Client created after t.
+// The server does not report when a key was created, so keys created by other clients
+// or before this Client was constructed are never returned.
+func (c *Client) ListAccessKeysCreatedAfter(t time.Time) ([]AccessKey, error) {
+	return c.ListAccessKeysCreatedAfterCtx(context.Background(), t)
+}
+
+func (c *Client) ListAccessKeysCreatedAfterCtx(ctx context.Context, t time.Time) ([]AccessKey, error) {
+	accessKeys, err := c.cachedAccessKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []AccessKey
+	for _, accessKey := range accessKeys {
+		if createdAt, ok := c.keyCreatedAt(accessKey.Id); ok && createdAt.After(t) {
+			result = append(result, accessKey)
 		}
-		c.accessKeysCache = accessKeysResponse.AccessKeys
 	}
+	return result, nil
+}
 
-	for _, accessKey := range c.accessKeysCache {
-		if _, ok := c.transferredDataCache[accessKey.Id]; !ok {
-			_, err := c.DeleteAccessKey(accessKey.Id)
-			if err != nil {
-				return false, err
-			}
+func (c *Client) DeleteAllKeysWithOutTraffic() (result bool, err error) {
+	return c.DeleteAllKeysWithOutTrafficCtx(context.Background())
+}
+
+// DeleteAllKeysWithOutTrafficCtx deletes, concurrently, every key that has no transferred data.
+// All keys are attempted; the failures are joined into the returned error.
+func (c *Client) DeleteAllKeysWithOutTrafficCtx(ctx context.Context) (result bool, err error) {
+	return c.DeleteAllKeysWithOutTrafficOlderThanCtx(ctx, 0)
+}
+
+// DeleteAllKeysWithOutTrafficOlderThan is like DeleteAllKeysWithOutTraffic but keeps keys
+// created by this Client less than minAge ago. The server does not report creation times,
+// so keys created elsewhere are always treated as old enough.
+func (c *Client) DeleteAllKeysWithOutTrafficOlderThan(minAge time.Duration) (result bool, err error) {
+	return c.DeleteAllKeysWithOutTrafficOlderThanCtx(context.Background(), minAge)
+}
+
+func (c *Client) DeleteAllKeysWithOutTrafficOlderThanCtx(ctx context.Context, minAge time.Duration) (result bool, err error) {
+	accessKeys, err := c.ListKeysWithoutTrafficCtx(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	ids := make([]string, 0, len(accessKeys))
+	for _, accessKey := range accessKeys {
+		if createdAt, ok := c.keyCreatedAt(accessKey.Id); ok && time.Since(createdAt) < minAge {
+			continue
 		}
+		ids = append(ids, accessKey.Id)
+	}
+
+	bulkResult, err := c.DeleteAccessKeysCtx(ctx, ids)
+	if err != nil {
+		return false, err
+	}
+	if len(bulkResult.Failed) != 0 {
+		return false, bulkResult.Err()
 	}
 	return true, nil
 }
@@ -0,0 +1,105 @@
+package outline_lib
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDeleteForgetsKeyCreation(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id":"7","method":"aes-192-gcm"}`))
+		case http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL)
+	key, err := c.CreateAccessKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.keyCreatedAt(key.Id); !ok {
+		t.Fatal("creation of the key was not recorded")
+	}
+
+	if _, err := c.DeleteAccessKey(key.Id); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.keyCreatedAt(key.Id); ok || len(c.createdKeys) != 0 {
+		t.Errorf("creation times kept after delete: %v", c.createdKeys)
+	}
+}
+
+func TestCacheLoadOutdatedByCreate(t *testing.T) {
+	loads := map[string]func(c *Client) error{
+		"cachedAccessKeys": func(c *Client) error {
+			_, err := c.GetNumberOfUsers()
+			return err
+		},
+		"RefreshCache": func(c *Client) error {
+			return c.RefreshCache(context.Background())
+		},
+	}
+
+	for name, load := range loads {
+		t.Run(name, func(t *testing.T) {
+			var mu sync.Mutex
+			keys := []string{`{"id":"1"}`}
+			listing, release := make(chan struct{}), make(chan struct{})
+			var slowList sync.Once
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == http.MethodGet && r.URL.Path == "/access-keys":
+					mu.Lock()
+					body := `{"accessKeys":[` + strings.Join(keys, ",") + `]}`
+					mu.Unlock()
+					// The first list holds its snapshot until the test has created a key
+					slowList.Do(func() {
+						close(listing)
+						<-release
+					})
+					w.Write([]byte(body))
+				case r.Method == http.MethodGet && r.URL.Path == "/metrics/transfer":
+					w.Write([]byte(`{"bytesTransferredByUserId":{}}`))
+				case r.Method == http.MethodPost && r.URL.Path == "/access-keys":
+					mu.Lock()
+					keys = append(keys, `{"id":"2"}`)
+					mu.Unlock()
+					w.WriteHeader(http.StatusCreated)
+					w.Write([]byte(`{"id":"2"}`))
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer srv.Close()
+
+			c := NewClient(srv.URL)
+			done := make(chan error, 1)
+			go func() { done <- load(c) }()
+
+			<-listing
+			if _, err := c.CreateAccessKey(); err != nil {
+				t.Fatal(err)
+			}
+			close(release)
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+
+			if n, err := c.GetNumberOfUsers(); err != nil || n != 2 {
+				t.Errorf("got %d users, %v after the create, want 2: the outdated list was cached", n, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package outline_lib
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrInvalidAPIURL is returned by Ping when the API URL does not lead to an Outline server
+	ErrInvalidAPIURL = errors.New("invalid api url")
+	// ErrBadCertificate is returned by Ping when the TLS handshake or the certificate pin fails
+	ErrBadCertificate = errors.New("bad server certificate")
+	// ErrServerUnreachable is returned by Ping when the server cannot be reached or is failing
+	ErrServerUnreachable = errors.New("server unreachable")
+	// ErrPortClosed is returned by TestAccessKey when the port of a key does not accept connections
+	ErrPortClosed = errors.New("access key port closed")
+)
+
+// defaultDialTestTimeout bounds the TCP dial of TestAccessKey
+const defaultDialTestTimeout = 5 * time.Second
+
+// Ping checks that the API URL and certificate are valid by requesting GET /server.
+// Failures wrap ErrInvalidAPIURL, ErrBadCertificate or ErrServerUnreachable.
+func (c *Client) Ping(ctx context.Context) error {
+	if err := validateAPIURL(c.ApiUrl); err != nil {
+		return err
+	}
+
+	ctx, cancel := withTimeout(ctx, c.Timeouts.get(c.Timeouts.ServerInfo, defaultServerInfoTimeout))
+	defer cancel()
+
+	if _, _, err := c.fetch(ctx, "GET", "/server", nil, nil); err != nil {
+		return classifyConnError(err)
+	}
+	return nil
+}
+
+func classifyConnError(err error) error {
+	var (
+		apiErr *APIError
+		dnsErr *net.DNSError
+	)
+
+	switch {
+	case errors.As(err, &apiErr):
+		if apiErr.StatusCode == http.StatusNotFound || apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden {
+			return fmt.Errorf("%w: %w", ErrInvalidAPIURL, err)
+		}
+		return fmt.Errorf("%w: %w", ErrServerUnreachable, err)
+	case isCertificateError(err):
+		return fmt.Errorf("%w: %w", ErrBadCertificate, err)
+	case errors.As(err, &dnsErr):
+		return fmt.Errorf("%w: %w", ErrInvalidAPIURL, err)
+	}
+
+	// Refused connections, timeouts and dropped connections
+	return fmt.Errorf("%w: %w", ErrServerUnreachable, err)
+}
+
+// isCertificateError reports whether err means the server certificate was rejected or the server
+// does not speak TLS, failures that persist until the server or the client configuration changes
+func isCertificateError(err error) bool {
+	var (
+		verifyErr    *tls.CertificateVerificationError
+		recordErr    tls.RecordHeaderError
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+	)
+	return errors.Is(err, ErrCertificateMismatch) ||
+		errors.As(err, &verifyErr) ||
+		errors.As(err, &recordErr) ||
+		errors.As(err, &authorityErr) ||
+		errors.As(err, &hostnameErr) ||
+		errors.As(err, &invalidErr)
+}
+
+// WaitForServer polls GET /server every interval until it succeeds or ctx is done,
+// in which case the last failure is returned along with the context error.
+// A non-positive interval is an error.
+func (c *Client) WaitForServer(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid poll interval %s", interval)
+	}
+	if err := validateAPIURL(c.ApiUrl); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		err := c.Ping(ctx)
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("server not ready: %w: %w", ctx.Err(), err)
+		case <-ticker.C:
+		}
+	}
+}
+
+// TestAccessKey checks that a client could connect to the host and port of the accessUrl of a key
+// by opening a TCP connection; no Shadowsocks handshake is performed. Failures wrap
+// ErrHostnameNotResolved if the host does not resolve and ErrPortClosed if the connection
+// is refused or times out, e.g. because of a firewall.
+func (c *Client) TestAccessKey(ctx context.Context, id string) (bool, error) {
+	key, err := c.FetchAccessKey(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	cfg, err := key.ParseAccessURL()
+	if err != nil {
+		return false, err
+	}
+
+	ctx, cancel := withTimeout(ctx, c.Timeouts.get(0, defaultDialTestTimeout))
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)))
+	if err != nil {
+		return false, classifyDialError(err)
+	}
+	conn.Close()
+	return true, nil
+}
+
+func classifyDialError(err error) error {
+	var (
+		dnsErr *net.DNSError
+		netErr net.Error
+	)
+
+	switch {
+	case errors.As(err, &dnsErr):
+		return fmt.Errorf("%w: %w", ErrHostnameNotResolved, err)
+	case errors.Is(err, syscall.ECONNREFUSED), errors.As(err, &netErr) && netErr.Timeout():
+		return fmt.Errorf("%w: %w", ErrPortClosed, err)
+	}
+	return err
+}
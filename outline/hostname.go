@@ -0,0 +1,67 @@
+package outline_lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+var (
+	// ErrInvalidHostname is returned for hostnames that are neither a valid DNS name nor an IP address
+	ErrInvalidHostname = errors.New("invalid hostname")
+	// ErrHostnameNotResolved is returned when a hostname has no A or AAAA record
+	ErrHostnameNotResolved = errors.New("hostname does not resolve")
+)
+
+// ChangeHostnameChecked is like ChangeHostname but, when resolve is set, also requires the
+// hostname to resolve to at least one address before changing it, since the hostname
+// is embedded in every access URL
+func (c *Client) ChangeHostnameChecked(ctx context.Context, hostname string, resolve bool) (bool, error) {
+	if err := validateHostname(hostname); err != nil {
+		return false, err
+	}
+	if resolve {
+		if err := resolveHostname(ctx, hostname); err != nil {
+			return false, err
+		}
+	}
+	return c.sendServerPutRequest(ctx, "/server/hostname-for-access-keys", map[string]string{"hostname": hostname})
+}
+
+// validateHostname accepts IP addresses and syntactically valid DNS names
+func validateHostname(hostname string) error {
+	if net.ParseIP(hostname) != nil {
+		return nil
+	}
+	if hostname == "" || len(hostname) > 253 {
+		return fmt.Errorf("%w: %q", ErrInvalidHostname, hostname)
+	}
+
+	for _, label := range strings.Split(hostname, ".") {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("%w: %q", ErrInvalidHostname, hostname)
+		}
+		for _, r := range label {
+			if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '-' {
+				return fmt.Errorf("%w: %q", ErrInvalidHostname, hostname)
+			}
+		}
+	}
+	return nil
+}
+
+func resolveHostname(ctx context.Context, hostname string) error {
+	if net.ParseIP(hostname) != nil {
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, hostname)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrHostnameNotResolved, err)
+	}
+	if len(addrs) == 0 {
+		return fmt.Errorf("%w: %q", ErrHostnameNotResolved, hostname)
+	}
+	return nil
+}
@@ -0,0 +1,319 @@
+package outline_lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// FindAccessKeysByName returns the keys whose name contains pattern, ignoring case,
+// or matches the regular expression pattern when regex is set
+func (c *Client) FindAccessKeysByName(pattern string, regex bool) ([]AccessKey, error) {
+	return c.FindAccessKeysByNameCtx(context.Background(), pattern, regex)
+}
+
+func (c *Client) FindAccessKeysByNameCtx(ctx context.Context, pattern string, regex bool) ([]AccessKey, error) {
+	match := func(name string) bool {
+		return strings.Contains(strings.ToLower(name), strings.ToLower(pattern))
+	}
+	if regex {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid name pattern: %w", err)
+		}
+		match = re.MatchString
+	}
+
+	accessKeysResponse, err := c.GetListAccessKeysCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []AccessKey
+	for _, key := range accessKeysResponse.AccessKeys {
+		if match(key.Name) {
+			result = append(result, key)
+		}
+	}
+	return result, nil
+}
+
+// FindDuplicateKeyNames returns the ids of the keys sharing a name, for every name used more than once.
+// Keys without a name are ignored.
+func (c *Client) FindDuplicateKeyNames() (map[string][]string, error) {
+	return c.FindDuplicateKeyNamesCtx(context.Background())
+}
+
+func (c *Client) FindDuplicateKeyNamesCtx(ctx context.Context) (map[string][]string, error) {
+	accessKeysResponse, err := c.GetListAccessKeysCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string][]string)
+	for _, key := range accessKeysResponse.AccessKeys {
+		if key.Name == "" {
+			continue
+		}
+		byName[key.Name] = append(byName[key.Name], key.Id)
+	}
+
+	result := make(map[string][]string)
+	for name, ids := range byName {
+		if len(ids) > 1 {
+			result[name] = ids
+		}
+	}
+	return result, nil
+}
+
+// UsedPorts returns the ids of the keys on every port in use, e.g. to pick a free port
+// before calling ChangeAccessKeyPort
+func (c *Client) UsedPorts() (map[int][]string, error) {
+	return c.UsedPortsCtx(context.Background())
+}
+
+func (c *Client) UsedPortsCtx(ctx context.Context) (map[int][]string, error) {
+	accessKeysResponse, err := c.GetListAccessKeysCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[int][]string)
+	for _, key := range accessKeysResponse.AccessKeys {
+		result[key.Port] = append(result[key.Port], key.Id)
+	}
+	return result, nil
+}
+
+// CreateFailure is a key CreateManyAccessKeys failed to create
+type CreateFailure struct {
+	Index  int
+	Params AccessKeyParams
+	Err    error
+}
+
+// CreateManyError is returned by CreateManyAccessKeys when some keys could not be created.
+// Failures hold the params of each of them, so they can be retried with CreateAccessKeyWithParams.
+type CreateManyError struct {
+	Failures []CreateFailure
+	Total    int
+}
+
+func (e *CreateManyError) Error() string {
+	return fmt.Sprintf("failed to create %d of %d access keys: %v", len(e.Failures), e.Total, e.Failures[0].Err)
+}
+
+func (e *CreateManyError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failures))
+	for _, failure := range e.Failures {
+		errs = append(errs, failure.Err)
+	}
+	return errs
+}
+
+// CreateManyAccessKeys creates count keys concurrently with the same params.
+// Every %d in params.Name is replaced with the 1-based index of the key.
+// It returns the created keys, and a *CreateManyError if some of them failed.
+// A count of 0 creates nothing, a negative count is an error, and so is params.Id for more than one key.
+func (c *Client) CreateManyAccessKeys(count int, params AccessKeyParams) ([]AccessKey, error) {
+	return c.CreateManyAccessKeysCtx(context.Background(), count, params)
+}
+
+func (c *Client) CreateManyAccessKeysCtx(ctx context.Context, count int, params AccessKeyParams) ([]AccessKey, error) {
+	if count < 0 {
+		return nil, fmt.Errorf("invalid key count %d", count)
+	}
+	if count == 0 {
+		return nil, nil
+	}
+	if count > 1 && params.Id != "" {
+		return nil, fmt.Errorf("cannot create %d access keys with the same id %q", count, params.Id)
+	}
+	if _, err := params.request(); err != nil {
+		return nil, err
+	}
+
+	keyParams := make([]AccessKeyParams, count)
+	keys := make([]AccessKey, count)
+	for i := range keyParams {
+		keyParams[i] = params
+		keyParams[i].Name = strings.ReplaceAll(params.Name, "%d", strconv.Itoa(i+1))
+	}
+
+	errs, started := c.runConcurrently(ctx, count, func(ctx context.Context, i int) (err error) {
+		keys[i], err = c.CreateAccessKeyWithParamsCtx(ctx, keyParams[i])
+		return err
+	})
+
+	var created []AccessKey
+	createErr := &CreateManyError{Total: count}
+	for i := range keys {
+		switch {
+		case !started[i]:
+			createErr.Failures = append(createErr.Failures, CreateFailure{Index: i + 1, Params: keyParams[i], Err: ctx.Err()})
+		case errs[i] != nil:
+			createErr.Failures = append(createErr.Failures, CreateFailure{Index: i + 1, Params: keyParams[i], Err: errs[i]})
+		default:
+			created = append(created, keys[i])
+		}
+	}
+	if len(createErr.Failures) != 0 {
+		return created, createErr
+	}
+	return created, nil
+}
+
+// RotateAccessKeyPassword replaces the password of a key, keeping its id, name, port, method
+// and data limit, and returns the key with its new accessUrl. An empty newPassword lets the
+// server generate one.
+//
+// The Outline API cannot modify the secret of an existing key, so the key
+// is deleted and created again with the same id.
+func (c *Client) RotateAccessKeyPassword(id string, newPassword string) (AccessKey, error) {
+	return c.RotateAccessKeyPasswordCtx(context.Background(), id, newPassword)
+}
+
+func (c *Client) RotateAccessKeyPasswordCtx(ctx context.Context, id string, newPassword string) (AccessKey, error) {
+	return c.replaceAccessKey(ctx, id, func(params *AccessKeyParams) {
+		params.Password = newPassword
+	})
+}
+
+// ChangeAccessKeyPort moves a key to another port. It returns ErrPortConflict if the
+// port is used by another service. Like RotateAccessKeyPassword, the key is recreated with
+// the same id, name, method, password and data limit.
+func (c *Client) ChangeAccessKeyPort(id string, port int) (bool, error) {
+	return c.ChangeAccessKeyPortCtx(context.Background(), id, port)
+}
+
+func (c *Client) ChangeAccessKeyPortCtx(ctx context.Context, id string, port int) (bool, error) {
+	if err := validatePort(port); err != nil {
+		return false, err
+	}
+
+	_, err := c.replaceAccessKey(ctx, id, func(params *AccessKeyParams) {
+		params.Port = port
+	})
+	if err != nil {
+		return false, wrapPortConflict(err)
+	}
+	return true, nil
+}
+
+// CreateAccessKeyWithID creates a key with a caller-chosen id, which takes precedence over params.Id.
+// If a key with that id already exists it is returned unchanged, so retrying the call never creates
+// a duplicate key.
+func (c *Client) CreateAccessKeyWithID(id string, params AccessKeyParams) (AccessKey, error) {
+	return c.CreateAccessKeyWithIDCtx(context.Background(), id, params)
+}
+
+func (c *Client) CreateAccessKeyWithIDCtx(ctx context.Context, id string, params AccessKeyParams) (AccessKey, error) {
+	params = c.withKeyDefaults(params)
+
+	ctx, cancel := withTimeout(ctx, c.Timeouts.get(c.Timeouts.CreateKey, defaultCreateKeyTimeout))
+	defer cancel()
+
+	key, err := c.putAccessKey(ctx, id, params)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict {
+		// An earlier attempt already created the key
+		return c.FetchAccessKey(ctx, id)
+	}
+	if err != nil {
+		return AccessKey{}, err
+	}
+	c.recordKeyCreation(key.Id)
+
+	if params.DataLimitBytes != nil {
+		return c.ensureDataLimit(ctx, key, *params.DataLimitBytes)
+	}
+	return key, nil
+}
+
+// CloneAccessKey creates a new key with the port, method and data limit of the key with the given id,
+// named after it with a " (copy)" suffix. The new key gets its own password.
+func (c *Client) CloneAccessKey(id string) (AccessKey, error) {
+	return c.CloneAccessKeyCtx(context.Background(), id)
+}
+
+func (c *Client) CloneAccessKeyCtx(ctx context.Context, id string) (AccessKey, error) {
+	key, err := c.FetchAccessKey(ctx, id)
+	if err != nil {
+		return AccessKey{}, err
+	}
+
+	params := paramsFromKey(key)
+	params.Name = key.Name + " (copy)"
+	params.Password = ""
+	return c.CreateAccessKeyWithParamsCtx(ctx, params)
+}
+
+// replaceAccessKey recreates the key with the same id and the settings changed by update.
+// If the new key cannot be created, the original one is restored.
+func (c *Client) replaceAccessKey(ctx context.Context, id string, update func(params *AccessKeyParams)) (AccessKey, error) {
+	key, err := c.FetchAccessKey(ctx, id)
+	if err != nil {
+		return AccessKey{}, err
+	}
+
+	original := paramsFromKey(key)
+	params := original
+	update(&params)
+	if _, err := params.request(); err != nil {
+		return AccessKey{}, err
+	}
+	// DeleteAccessKeyCtx forgets when this Client created the key, the recreated key keeps that time
+	createdAt, created := c.keyCreatedAt(id)
+	if _, err := c.DeleteAccessKeyCtx(ctx, id); err != nil {
+		return AccessKey{}, err
+	}
+
+	result, err := c.putAccessKey(ctx, id, params)
+	if err != nil {
+		if _, restoreErr := c.putAccessKey(context.WithoutCancel(ctx), id, original); restoreErr != nil {
+			return AccessKey{}, errors.Join(err, fmt.Errorf("failed to restore access key %s: %w", id, restoreErr))
+		}
+		if created {
+			c.setKeyCreation(id, createdAt)
+		}
+		return AccessKey{}, err
+	}
+	if created {
+		c.setKeyCreation(id, createdAt)
+	}
+	return result, nil
+}
+
+// putAccessKey creates a key with the given id
+func (c *Client) putAccessKey(ctx context.Context, id string, params AccessKeyParams) (result AccessKey, err error) {
+	data, err := params.request()
+	if err != nil {
+		return result, err
+	}
+
+	if _, err := c.sendPutRequestDecode(ctx, accessKeyPath(id), data, &result); err != nil {
+		return result, err
+	}
+	c.invalidateAccessKeysCache()
+	return result, nil
+}
+
+// paramsFromKey returns the settings needed to create an identical key
+func paramsFromKey(key AccessKey) AccessKeyParams {
+	params := AccessKeyParams{
+		Name:     key.Name,
+		Port:     key.Port,
+		Method:   key.Method,
+		Password: key.Password,
+	}
+	if key.DataLimit != nil {
+		limit := key.DataLimit.Bytes
+		params.DataLimitBytes = &limit
+	}
+	return params
+}
@@ -0,0 +1,92 @@
+package outline_lib
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// RequestInfo describes a completed MakeRequest call
+type RequestInfo struct {
+	Method string
+	// Endpoint is the path with ids replaced by placeholders, e.g. /access-keys/{id}/name,
+	// and without the query string, so it can be used as a metric label
+	Endpoint string
+	Status   int // 0 if no response was received
+	Elapsed  time.Duration
+	Err      error
+}
+
+// endpointTemplate replaces the access key id in endpoint with {id} and drops the query string
+func endpointTemplate(endpoint string) string {
+	endpoint, _, _ = strings.Cut(endpoint, "?")
+
+	rest, ok := strings.CutPrefix(endpoint, "/access-keys/")
+	if !ok || rest == "" {
+		return endpoint
+	}
+	if _, suffix, found := strings.Cut(rest, "/"); found {
+		return "/access-keys/{id}/" + suffix
+	}
+	return "/access-keys/{id}"
+}
+
+// logRequest and logResponse only log the endpoint, because ApiUrl contains the API secret;
+// errors are logged with the request URL redacted
+
+func (c *Client) logRequest(ctx context.Context, method, endpoint string, attempt int) {
+	if c.Logger == nil {
+		return
+	}
+	c.Logger.LogAttrs(ctx, slog.LevelDebug, "outline request",
+		slog.String("method", method),
+		slog.String("endpoint", endpoint),
+		slog.Int("attempt", attempt),
+	)
+}
+
+func (c *Client) logResponse(ctx context.Context, method, endpoint string, resp *http.Response, err error, elapsed time.Duration) {
+	if c.Logger == nil {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("method", method),
+		slog.String("endpoint", endpoint),
+		slog.Int("status", responseStatus(resp, err)),
+		slog.Duration("duration", elapsed),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", c.redactError(err, endpoint)))
+	}
+	c.Logger.LogAttrs(ctx, slog.LevelDebug, "outline response", attrs...)
+}
+
+// redactError returns the message of err with the request URL replaced by endpoint
+// and any other occurrence of ApiUrl removed
+func (c *Client) redactError(err error, endpoint string) string {
+	msg := err.Error()
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) && urlErr.URL != "" {
+		msg = strings.ReplaceAll(msg, urlErr.URL, endpoint)
+	}
+	if apiURL := strings.TrimRight(c.ApiUrl, "/"); apiURL != "" {
+		msg = strings.ReplaceAll(msg, apiURL, "<api url>")
+	}
+	return msg
+}
+
+// responseStatus returns the HTTP status of a request, or 0 if no response was received
+func responseStatus(resp *http.Response, err error) int {
+	if resp != nil {
+		return resp.StatusCode
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
@@ -0,0 +1,29 @@
+package outline_lib
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLogResponseRedactsApiUrl(t *testing.T) {
+	for _, apiURL := range []string{
+		"http://127.0.0.1:1/SECRET", // connection refused
+		"http://bad host:1/SECRET/", // request cannot be built
+	} {
+		var buf bytes.Buffer
+		c := NewClient(apiURL)
+		c.Logger = slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+		if _, err := c.GetServerInfo(); err == nil {
+			t.Fatalf("GetServerInfo with ApiUrl %q succeeded", apiURL)
+		}
+		if !strings.Contains(buf.String(), "error=") {
+			t.Errorf("no error logged for ApiUrl %q:\n%s", apiURL, buf.String())
+		}
+		if strings.Contains(buf.String(), "SECRET") {
+			t.Errorf("log output contains the API secret:\n%s", buf.String())
+		}
+	}
+}
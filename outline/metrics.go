@@ -0,0 +1,155 @@
+package outline_lib
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ExperimentalMetrics is the response of GET /experimental/server/metrics
+type ExperimentalMetrics struct {
+	Server     ServerMetrics      `json:"server"`
+	AccessKeys []AccessKeyMetrics `json:"accessKeys"`
+}
+
+type ServerMetrics struct {
+	TunnelTime      TunnelTime        `json:"tunnelTime"`
+	DataTransferred DataTransferred   `json:"dataTransferred"`
+	Bandwidth       Bandwidth         `json:"bandwidth"`
+	Locations       []LocationMetrics `json:"locations"`
+}
+
+type LocationMetrics struct {
+	Location        string          `json:"location"`
+	Asn             int64           `json:"asn"`
+	AsOrg           string          `json:"asOrg"`
+	TunnelTime      TunnelTime      `json:"tunnelTime"`
+	DataTransferred DataTransferred `json:"dataTransferred"`
+}
+
+type AccessKeyMetrics struct {
+	// AccessKeyId is sent as a number by current servers, json.Number accepts a string too
+	AccessKeyId     json.Number       `json:"accessKeyId"`
+	TunnelTime      TunnelTime        `json:"tunnelTime"`
+	DataTransferred DataTransferred   `json:"dataTransferred"`
+	Connection      ConnectionMetrics `json:"connection"`
+}
+
+type ConnectionMetrics struct {
+	LastTrafficSeen int64 `json:"lastTrafficSeen"` // unix seconds
+	PeakDeviceCount struct {
+		Data      int64 `json:"data"`
+		Timestamp int64 `json:"timestamp"` // unix seconds
+	} `json:"peakDeviceCount"`
+}
+
+type Bandwidth struct {
+	Current BandwidthSample `json:"current"`
+	Peak    BandwidthSample `json:"peak"`
+}
+
+type BandwidthSample struct {
+	Data      DataTransferred `json:"data"`
+	Timestamp int64           `json:"timestamp"` // unix seconds
+}
+
+type TunnelTime struct {
+	Seconds int64 `json:"seconds"`
+}
+
+type DataTransferred struct {
+	Bytes int64 `json:"bytes"`
+}
+
+// GetExperimentalMetrics returns the per-server, per-location and per-key metrics
+// collected over the since period, e.g. "30d" or "24h".
+// It returns an *UnsupportedVersionError if the server is too old to provide them.
+func (c *Client) GetExperimentalMetrics(ctx context.Context, since string) (result ExperimentalMetrics, err error) {
+	ctx, cancel := withTimeout(ctx, c.Timeouts.get(c.Timeouts.TransferData, defaultTransferDataTimeout))
+	defer cancel()
+
+	if err := c.requireFeature(ctx, FeatureExperimentalMetrics); err != nil {
+		return result, err
+	}
+
+	endpoint := "/experimental/server/metrics?since=" + url.QueryEscape(since)
+	_, data, err := c.fetch(ctx, "GET", endpoint, nil, nil)
+	if err != nil {
+		return result, wrapNotSupported(err)
+	}
+
+	err = parseJSON(data, &result)
+	return
+}
+
+// GetPrometheusMetrics reads the Prometheus text format from GET /metrics and returns every sample
+// keyed by its series, e.g. `shadowsocks_tunnel_time_seconds{access_key="1"}`.
+// It returns ErrNotSupported if the server does not expose the endpoint.
+func (c *Client) GetPrometheusMetrics(ctx context.Context) (map[string]float64, error) {
+	ctx, cancel := withTimeout(ctx, c.Timeouts.get(c.Timeouts.Metrics, defaultMetricsTimeout))
+	defer cancel()
+
+	resp, err := c.MakeRequest(ctx, "GET", "/metrics", map[string]string{"Accept": "text/plain"}, nil)
+	if err != nil {
+		return nil, wrapNotSupported(err)
+	}
+	defer drainAndClose(resp.Body)
+
+	return parsePrometheusText(resp.Body)
+}
+
+// ResetTransferMetrics zeroes the transferred bytes of every access key on servers that allow it,
+// such as some Outline forks. It returns an *UnsupportedVersionError without sending the request
+// if the server is older than FeatureResetTransferMetrics requires. Newer stock servers still lack
+// the endpoint, so ErrNotSupported is also returned when the server rejects it.
+func (c *Client) ResetTransferMetrics(ctx context.Context) error {
+	if err := c.requireFeature(ctx, FeatureResetTransferMetrics); err != nil {
+		return err
+	}
+	if _, err := c.sendDeleteRequest(ctx, "/metrics/transfer"); err != nil {
+		return wrapNotSupported(err)
+	}
+	c.invalidateTransferredDataCache()
+	return nil
+}
+
+// parsePrometheusText parses the samples of the Prometheus text exposition format, skipping comments
+func parsePrometheusText(r io.Reader) (map[string]float64, error) {
+	result := make(map[string]float64)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// The series ends at the closing brace of its labels, or at the first space without labels
+		end := strings.LastIndexByte(line, '}') + 1
+		if end == 0 {
+			end = strings.IndexAny(line, " \t")
+		}
+		if end <= 0 {
+			return nil, fmt.Errorf("invalid metrics line %q", line)
+		}
+
+		fields := strings.Fields(line[end:])
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("invalid metrics line %q", line)
+		}
+		value, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metrics value in %q: %w", line, err)
+		}
+		result[line[:end]] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read metrics: %w", err)
+	}
+	return result, nil
+}
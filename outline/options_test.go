@@ -0,0 +1,70 @@
+package outline_lib
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTLSHandshakeTimeout(t *testing.T) {
+	// A listener that accepts connections but never answers the ClientHello
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		var conns []net.Conn
+		defer func() {
+			for _, conn := range conns {
+				conn.Close()
+			}
+		}()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+
+	c, err := NewClientWithOptions("https://"+ln.Addr().String(), WithTLSHandshakeTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.GetServerInfo()
+
+	var handshakeErr *TLSHandshakeError
+	if !errors.As(err, &handshakeErr) || !errors.Is(err, ErrTimeout) {
+		t.Errorf("got %v, want a *TLSHandshakeError matching ErrTimeout", err)
+	}
+}
+
+func TestTLSHandshakeErrorOnlyForHandshakes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	addr := srv.Listener.Addr().String()
+	srv.Close()
+
+	// Nothing listens on addr any more, so the request fails before any handshake
+	_, err := NewClient("https://" + addr).GetServerInfo()
+	var handshakeErr *TLSHandshakeError
+	if err == nil || errors.As(err, &handshakeErr) {
+		t.Errorf("got %v, want a connection error that is not a *TLSHandshakeError", err)
+	}
+}
+
+func TestDurationOptionsRejectNonPositive(t *testing.T) {
+	for name, opt := range map[string]func(time.Duration) Option{
+		"WithDefaultTimeout":      WithDefaultTimeout,
+		"WithDialTimeout":         WithDialTimeout,
+		"WithTLSHandshakeTimeout": WithTLSHandshakeTimeout,
+	} {
+		if _, err := NewClientWithOptions("https://127.0.0.1", opt(0)); err == nil {
+			t.Errorf("%s(0) was accepted", name)
+		}
+	}
+}
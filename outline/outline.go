@@ -3,33 +3,163 @@ package outline_lib
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"crypto/subtle"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type AccessKey struct {
-	Id        string `json:"id"`
-	Name      string `json:"name"`
-	Password  string `json:"password"`
-	Port      int    `json:"port"`
-	Method    string `json:"method"`
-	AccessUrl string `json:"accessUrl"`
+	Id        string     `json:"id"`
+	Name      string     `json:"name"`
+	Password  string     `json:"password"`
+	Port      int        `json:"port"`
+	Method    string     `json:"method"`
+	AccessUrl string     `json:"accessUrl"`
+	DataLimit *DataLimit `json:"dataLimit,omitempty"`
+}
+
+type DataLimit struct {
+	Bytes int64 `json:"bytes"`
+}
+
+// AccessKeyParams holds the optional settings of a new access key.
+// Zero values are left for the server to choose, except Method which defaults to
+// Client.DefaultMethod, or aes-192-gcm if that is empty. An empty Id lets the server
+// assign one.
+type AccessKeyParams struct {
+	Id             string
+	Name           string
+	Port           int
+	Method         string
+	Password       string
+	DataLimitBytes *int64
+}
+
+type createAccessKeyRequest struct {
+	Method   string     `json:"method"`
+	Name     string     `json:"name,omitempty"`
+	Password string     `json:"password,omitempty"`
+	Port     int        `json:"port,omitempty"`
+	Limit    *DataLimit `json:"limit,omitempty"`
+}
+
+func (p AccessKeyParams) request() (createAccessKeyRequest, error) {
+	req := createAccessKeyRequest{
+		Method:   p.Method,
+		Name:     p.Name,
+		Password: p.Password,
+		Port:     p.Port,
+	}
+	if req.Method == "" {
+		req.Method = defaultMethod
+	}
+	if err := validateMethod(req.Method); err != nil {
+		return req, err
+	}
+	if req.Port != 0 {
+		if err := validatePort(req.Port); err != nil {
+			return req, err
+		}
+	}
+	if p.DataLimitBytes != nil {
+		req.Limit = &DataLimit{Bytes: *p.DataLimitBytes}
+	}
+	return req, nil
 }
 
 type AccessKeysResponse struct {
 	AccessKeys []AccessKey `json:"accessKeys"`
 }
 
+// Client talks to the Outline management API.
+// Once configured, a Client is safe for concurrent use by multiple goroutines.
 type Client struct {
-	ApiUrl               string
-	httpClient           *http.Client
+	ApiUrl      string
+	Timeouts    Timeouts
+	RetryPolicy RetryPolicy
+	BulkWorkers int // concurrent requests used by bulk operations, 8 if zero
+	// DefaultKeyName names keys created without a name. Every %d in it is replaced
+	// with a counter starting at 1 and kept by the Client.
+	DefaultKeyName string
+	// DefaultMethod is the cipher of keys created without a method, aes-192-gcm if empty
+	DefaultMethod string
+	// DefaultHeaders are sent with every request, replacing the User-Agent and Accept headers set by default.
+	// Headers passed to MakeRequest take precedence. Names are canonicalized like http.Header.Set.
+	// The map must not be changed once the Client is in use; SetAuthToken can change the Authorization header.
+	DefaultHeaders map[string]string
+	// OnRequest, if set, is called after every MakeRequest call, including all its retries
+	OnRequest func(info RequestInfo)
+	// Logger receives a debug record before and after each request, nothing is logged if nil
+	Logger *slog.Logger
+
+	certSha256 string
+	httpClient *http.Client
+	userAgent  string
+	limiter    *rateLimiter
+	keyCounter atomic.Int64
+	authToken  atomic.Pointer[string] // set by SetAuthToken
+
+	// cacheMu guards accessKeysCache, transferredDataCache, serverInfoCache, cacheGen and createdKeys.
+	// The cached values are replaced as a whole and never modified in place.
+	cacheMu              sync.RWMutex
 	accessKeysCache      []AccessKey
 	transferredDataCache map[string]int64
+	serverInfoCache      *ServerResponse
+	// cacheGen is incremented by every change to accessKeysCache and transferredDataCache, so loads
+	// started before the change do not store their outdated result
+	cacheGen uint64
+	// createdKeys records when this Client created each existing key, since the server does not report it
+	createdKeys map[string]time.Time
+	// cacheFills deduplicates concurrent loads of an empty cache
+	cacheFills flightGroup
+}
+
+// Timeouts configures how long each kind of request may take when the caller's
+// context has no deadline. A zero field falls back to Default, and a zero Default
+// falls back to the built-in value noted next to each field.
+type Timeouts struct {
+	Default        time.Duration
+	ServerInfo     time.Duration // GetServerInfo, 5s
+	Metrics        time.Duration // CheckMetrics, 10s
+	CreateKey      time.Duration // CreateAccessKey, 5s
+	ListKeys       time.Duration // GetListAccessKeys, 15s
+	TransferData   time.Duration // DataTransferredAccessKey, 30s
+	ModifyRequests time.Duration // PUT and DELETE requests, 10s
+}
+
+const (
+	defaultServerInfoTimeout     = 5 * time.Second
+	defaultMetricsTimeout        = 10 * time.Second
+	defaultCreateKeyTimeout      = 5 * time.Second
+	defaultListKeysTimeout       = 15 * time.Second
+	defaultTransferDataTimeout   = 30 * time.Second
+	defaultModifyRequestsTimeout = 10 * time.Second
+	defaultRawTimeout            = 10 * time.Second
+)
+
+func (t Timeouts) get(override, builtin time.Duration) time.Duration {
+	if override > 0 {
+		return override
+	}
+	if t.Default > 0 {
+		return t.Default
+	}
+	return builtin
 }
 
 type MetricsResponse struct {
@@ -43,229 +173,970 @@ type Server struct {
 }
 
 type ServerResponse struct {
-	Name                  string `json:"name"`
-	ServerId              string `json:"serverId"`
-	MetricsEnabled        bool   `json:"metricsEnabled"`
-	CreatedTimestampMs    int64  `json:"createdTimestampMs"`
-	Version               string `json:"version"`
-	PortForNewAccessKeys  int    `json:"portForNewAccessKeys"`
-	HostnameForAccessKeys string `json:"hostnameForAccessKeys"`
+	Name                  string     `json:"name"`
+	ServerId              string     `json:"serverId"`
+	MetricsEnabled        bool       `json:"metricsEnabled"`
+	CreatedTimestampMs    int64      `json:"createdTimestampMs"`
+	Version               string     `json:"version"`
+	PortForNewAccessKeys  int        `json:"portForNewAccessKeys"`
+	HostnameForAccessKeys string     `json:"hostnameForAccessKeys"`
+	AccessKeyDataLimit    *DataLimit `json:"accessKeyDataLimit,omitempty"`
+}
+
+// CreatedAt returns the creation time of the server, or the zero time if the server did not report it
+func (s ServerResponse) CreatedAt() time.Time {
+	if s.CreatedTimestampMs <= 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(s.CreatedTimestampMs)
+}
+
+// Age returns how long ago the server was created, or 0 if the server did not report it
+func (s ServerResponse) Age() time.Duration {
+	createdAt := s.CreatedAt()
+	if createdAt.IsZero() {
+		return 0
+	}
+	return time.Since(createdAt)
 }
 
 type TransferData struct {
 	BytesTransferredByUserId map[string]int64 `json:"bytesTransferredByUserId"`
 }
 
+// Version is the version of this library, sent in the default User-Agent header
+const Version = "0.1.0"
+
+const defaultUserAgent = "go-outline-lib-api/" + Version
+
 const contentTypeJSON = "application/json"
 
+// jsonHeader is passed by requests with a JSON body; every request accepts JSON unless its headers say otherwise
 var jsonHeader = map[string]string{"Content-Type": contentTypeJSON}
 
-// NewClient returns a new instance of the Client
+// defaultMethod is the cipher used by CreateAccessKey when Client.DefaultMethod is empty
+const defaultMethod = "aes-192-gcm"
+
+// supportedMethods lists the AEAD ciphers accepted by the Outline server.
+// Every server version supporting the method parameter accepts the same set.
+var supportedMethods = []string{
+	"chacha20-ietf-poly1305",
+	"aes-128-gcm",
+	"aes-192-gcm",
+	"aes-256-gcm",
+}
+
+// NewClient returns a new instance of the Client.
+// For backward compatibility it does not verify the server certificate;
+// use NewClientWithCert or the WithSecureTLS option to enable verification.
 func NewClient(apiURL string) *Client {
+	return NewClientWithCert(apiURL, "")
+}
+
+// NewClientWithCert returns a new instance of the Client that pins the server
+// certificate to the given SHA-256 fingerprint (the certSha256 value of the Outline API config).
+// An empty fingerprint disables pinning. A malformed one makes every request fail; NewClientFromConfig
+// and WithCertSha256 reject it up front.
+func NewClientWithCert(apiURL, certSha256 string) *Client {
+	return &Client{
+		ApiUrl:     strings.TrimRight(apiURL, "/"),
+		certSha256: certSha256,
+		httpClient: newDefaultHTTPClient(certSha256),
+	}
+}
+
+// NewClientFromConfig returns a new instance of the Client from the JSON config shown by
+// Outline Manager, e.g. {"apiUrl":"https://1.2.3.4:1234/secret","certSha256":"..."}
+func NewClientFromConfig(jsonConfig string) (*Client, error) {
+	var config ClientConfig
+	if err := json.Unmarshal([]byte(jsonConfig), &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	if err := validateAPIURL(config.ApiUrl); err != nil {
+		return nil, err
+	}
+	if err := validateFingerprint(config.CertSha256); err != nil {
+		return nil, err
+	}
+
+	return NewClientWithCert(config.ApiUrl, config.CertSha256), nil
+}
+
+// ClientConfig is the persistable part of a Client, in the format of the Outline API config
+type ClientConfig struct {
+	ApiUrl     string `json:"apiUrl"`
+	CertSha256 string `json:"certSha256,omitempty"`
+}
+
+// NewClientFromStoredConfig returns a new instance of the Client from a config returned by Client.Config
+func NewClientFromStoredConfig(config ClientConfig) *Client {
+	return NewClientWithCert(config.ApiUrl, config.CertSha256)
+}
+
+// Config returns the API URL and certificate fingerprint of the Client
+func (c *Client) Config() ClientConfig {
+	return ClientConfig{
+		ApiUrl:     c.ApiUrl,
+		CertSha256: c.certSha256,
+	}
+}
+
+// validateAPIURL checks that apiURL is an absolute http(s) URL
+func validateAPIURL(apiURL string) error {
+	if apiURL == "" {
+		return fmt.Errorf("%w: apiUrl is missing", ErrInvalidAPIURL)
+	}
+	u, err := url.Parse(apiURL)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return fmt.Errorf("%w: %q", ErrInvalidAPIURL, apiURL)
+	}
+	return nil
+}
+
+// NewClientWithHTTPClient returns a new instance of the Client that sends requests with hc.
+// If hc is nil, the default transport is used.
+func NewClientWithHTTPClient(apiURL string, hc *http.Client) *Client {
+	if hc == nil {
+		return NewClient(apiURL)
+	}
+
+	return &Client{
+		ApiUrl:     strings.TrimRight(apiURL, "/"),
+		httpClient: hc,
+	}
+}
+
+// defaultTLSHandshakeTimeout bounds the TLS handshake of the default transport; it can be lowered
+// with WithTLSHandshakeTimeout. Dials have no timeout of their own unless set with WithDialTimeout.
+const defaultTLSHandshakeTimeout = 20 * time.Second
+
+func newDefaultHTTPClient(certSha256 string) *http.Client {
 	tr := &http.Transport{
 		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: true,
+			// The Outline server uses a self-signed certificate, so the chain and
+			// hostname are not verified; the fingerprint pin is checked instead.
+			InsecureSkipVerify:    true,
+			VerifyPeerCertificate: verifyCertSha256(certSha256),
 		},
 		MaxIdleConns:        20,
 		IdleConnTimeout:     20 * time.Second,
-		TLSHandshakeTimeout: 20 * time.Second,
+		TLSHandshakeTimeout: defaultTLSHandshakeTimeout,
 	}
 
-	return &Client{
-		ApiUrl: apiURL,
-		httpClient: &http.Client{
-			Transport: tr,
-		},
+	return &http.Client{
+		Transport: tr,
 	}
 }
 
+// verifyCertSha256 returns a callback comparing the SHA-256 of the leaf certificate with the fingerprint
+func verifyCertSha256(certSha256 string) func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	if certSha256 == "" {
+		return nil
+	}
+	expected := normalizeFingerprint(certSha256)
+
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return fmt.Errorf("%w: no certificate presented", ErrCertificateMismatch)
+		}
+		sum := sha256.Sum256(rawCerts[0])
+		actual := hex.EncodeToString(sum[:])
+		if subtle.ConstantTimeCompare([]byte(actual), []byte(expected)) != 1 {
+			return fmt.Errorf("%w: got %s", ErrCertificateMismatch, strings.ToUpper(actual))
+		}
+		return nil
+	}
+}
+
+// validateFingerprint accepts an empty fingerprint, which disables pinning, or a SHA-256 in hex
+// with optional colon separators
+func validateFingerprint(certSha256 string) error {
+	if certSha256 == "" {
+		return nil
+	}
+	fingerprint := normalizeFingerprint(certSha256)
+	if len(fingerprint) != 2*sha256.Size {
+		return fmt.Errorf("%w: %d hex digits, want %d", ErrInvalidCertSha256, len(fingerprint), 2*sha256.Size)
+	}
+	if _, err := hex.DecodeString(fingerprint); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidCertSha256, err)
+	}
+	return nil
+}
+
+// normalizeFingerprint lowercases the fingerprint and strips the separators some tools add
+func normalizeFingerprint(fingerprint string) string {
+	fingerprint = strings.ReplaceAll(fingerprint, ":", "")
+	return strings.ToLower(strings.TrimSpace(fingerprint))
+}
+
+// joinURL appends endpoint to the base URL with exactly one slash between them
+func joinURL(base, endpoint string) string {
+	return strings.TrimRight(base, "/") + "/" + strings.TrimLeft(endpoint, "/")
+}
+
+// SetAuthToken sends the token as a bearer Authorization header with every request,
+// for servers behind an authenticating reverse proxy. It may be called while requests are running,
+// e.g. to rotate an expiring token; an empty token stops sending the header.
+func (c *Client) SetAuthToken(token string) {
+	if token == "" {
+		c.authToken.Store(nil)
+		return
+	}
+	c.authToken.Store(&token)
+}
+
 // MakeRequest makes requests to server
-func (c *Client) MakeRequest(ctx context.Context, method, endpoint string, headers map[string]string, body io.Reader) (*http.Response, error) {
-	fullURL := c.ApiUrl + endpoint
+func (c *Client) MakeRequest(ctx context.Context, method, endpoint string, headers map[string]string, body io.Reader) (resp *http.Response, err error) {
+	if c.OnRequest != nil {
+		start := time.Now()
+		defer func() {
+			c.OnRequest(RequestInfo{
+				Method:   method,
+				Endpoint: endpointTemplate(endpoint),
+				Status:   responseStatus(resp, err),
+				Elapsed:  time.Since(start),
+				Err:      err,
+			})
+		}()
+	}
+
+	fullURL := joinURL(c.ApiUrl, endpoint)
+
+	// The body is buffered so it can be sent again when the request is retried
+	var payload []byte
+	if body != nil {
+		payload, err = io.ReadAll(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+	}
+
+	attempts := c.RetryPolicy.attempts(method)
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		c.logRequest(ctx, method, endpoint, attempt)
+		resp, err = c.doRequest(ctx, method, fullURL, headers, payload)
+		c.logResponse(ctx, method, endpoint, resp, err, time.Since(start))
+		if attempt >= attempts || !isRetryable(ctx, err) {
+			return resp, err
+		}
+		if !c.RetryPolicy.wait(ctx, attempt) {
+			return resp, err
+		}
+	}
+}
+
+func (c *Client) doRequest(ctx context.Context, method, fullURL string, headers map[string]string, payload []byte) (*http.Response, error) {
+	if c.limiter != nil {
+		if err := c.limiter.wait(ctx); err != nil {
+			return nil, wrapContextError(err)
+		}
+	}
+
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
 
 	req, err := http.NewRequestWithContext(ctx, method, fullURL, body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("%w: %w", errCreateRequest, err)
 	}
 
+	userAgent := c.userAgent
+	if userAgent == "" {
+		userAgent = defaultUserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", contentTypeJSON)
+	for key, value := range c.DefaultHeaders {
+		req.Header.Set(key, value)
+	}
+	if token := c.authToken.Load(); token != nil {
+		req.Header.Set("Authorization", "Bearer "+*token)
+	}
 	for key, value := range headers {
 		req.Header.Set(key, value)
 	}
 
+	req, handshakeFailed := traceTLSHandshake(req)
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
+		err = wrapContextError(fmt.Errorf("failed to execute request: %w", err))
+		if handshakeFailed.Load() {
+			return nil, &TLSHandshakeError{Err: err}
+		}
+		return nil, err
 	}
 
 	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("server responded with code %d", resp.StatusCode)
+		defer drainAndClose(resp.Body)
+		return nil, newAPIError(resp)
 	}
 
 	return resp, nil
 }
 
-func parseJSONFromReader(r io.Reader, v interface{}) error {
-	if r == nil {
-		return errors.New("reader is nil")
+// traceTLSHandshake returns req with a trace recording whether a TLS handshake for it failed,
+// including by exceeding the handshake timeout of the transport
+func traceTLSHandshake(req *http.Request) (*http.Request, *atomic.Bool) {
+	failed := new(atomic.Bool)
+	trace := &httptrace.ClientTrace{
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if err != nil {
+				failed.Store(true)
+			}
+		},
 	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace)), failed
+}
+
+// GetRaw sends a GET request to any endpoint of the API, e.g. "/server", and returns the response body.
+// Like other requests it fails with *APIError for 4xx and 5xx responses, and without a deadline
+// on ctx it uses Timeouts.Default, or 10s.
+func (c *Client) GetRaw(ctx context.Context, endpoint string) (json.RawMessage, error) {
+	ctx, cancel := withTimeout(ctx, c.Timeouts.get(0, defaultRawTimeout))
+	defer cancel()
 
-	decoder := json.NewDecoder(r)
-	return decoder.Decode(v)
+	_, body, err := c.fetch(ctx, http.MethodGet, endpoint, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) == 0 {
+		return nil, nil
+	}
+	return json.RawMessage(body), nil
+}
+
+// fetch calls MakeRequest, then reads the whole body and closes it, so the connection
+// goes back to the pool even if the caller fails to decode the body.
+// Only streaming calls use MakeRequest directly.
+func (c *Client) fetch(ctx context.Context, method, endpoint string, headers map[string]string, body io.Reader) (status int, data []byte, err error) {
+	resp, err := c.MakeRequest(ctx, method, endpoint, headers, body)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return resp.StatusCode, data, nil
+}
+
+// drainAndClose discards the rest of a body, up to maxErrorBodySize, and closes it
+// so the connection can be reused
+func drainAndClose(body io.ReadCloser) {
+	io.Copy(io.Discard, io.LimitReader(body, maxErrorBodySize))
+	body.Close()
+}
+
+// parseJSON decodes a JSON body into v. An empty body, as sent with 204 No Content,
+// leaves v unchanged and is not an error.
+func parseJSON(data []byte, v interface{}) error {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+// withTimeout applies the default timeout d only when ctx has no deadline of its own
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
 }
 
 func (c *Client) GetServerInfo() (result ServerResponse, err error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	return c.GetServerInfoCtx(context.Background())
+}
+
+func (c *Client) GetServerInfoCtx(ctx context.Context) (result ServerResponse, err error) {
+	ctx, cancel := withTimeout(ctx, c.Timeouts.get(c.Timeouts.ServerInfo, defaultServerInfoTimeout))
 	defer cancel()
 
-	resp, err := c.MakeRequest(ctx, "GET", "/server", map[string]string{"content-type": contentTypeJSON}, nil)
+	status, data, err := c.fetch(ctx, "GET", "/server", nil, nil)
 	if err != nil {
 		return ServerResponse{}, err
 	}
+	if status == http.StatusNoContent {
+		return ServerResponse{}, nil
+	}
 
-	err = parseJSONFromReader(resp.Body, &result)
+	err = parseJSON(data, &result)
 	if err != nil {
 		return ServerResponse{}, err
 	}
 
+	c.cacheMu.Lock()
+	c.serverInfoCache = &result
+	c.cacheMu.Unlock()
 	return
 }
 
+// ServerState combines GET /server with GET /metrics/enabled
+type ServerState struct {
+	Server ServerResponse
+	// MetricsEnabled is the value reported by /metrics/enabled, which is the one ChangeMetrics sets
+	MetricsEnabled bool
+	// MetricsMismatch is set when Server.MetricsEnabled disagrees with MetricsEnabled
+	MetricsMismatch bool
+}
+
+// GetServerState fetches the server info and the metrics sharing state and flags if they disagree
+func (c *Client) GetServerState(ctx context.Context) (ServerState, error) {
+	server, err := c.GetServerInfoCtx(ctx)
+	if err != nil {
+		return ServerState{}, err
+	}
+	metrics, err := c.CheckMetricsCtx(ctx)
+	if err != nil {
+		return ServerState{}, err
+	}
+
+	return ServerState{
+		Server:          server,
+		MetricsEnabled:  metrics.MetricsEnabled,
+		MetricsMismatch: server.MetricsEnabled != metrics.MetricsEnabled,
+	}, nil
+}
+
 func (c *Client) ChangeHostname(hostname string) (bool, error) {
-	return c.sendPutRequest("/server/hostname-for-access-keys", map[string]string{"hostname": hostname})
+	return c.ChangeHostnameCtx(context.Background(), hostname)
+}
+
+// ChangeHostnameCtx changes the hostname used in access URLs.
+// It returns ErrInvalidHostname if hostname is not a valid DNS name or IP address.
+func (c *Client) ChangeHostnameCtx(ctx context.Context, hostname string) (bool, error) {
+	return c.ChangeHostnameChecked(ctx, hostname, false)
 }
 
 func (c *Client) RenameServer(name string) (bool, error) {
-	return c.sendPutRequest("/name", map[string]string{"name": name})
+	return c.RenameServerCtx(context.Background(), name)
+}
+
+func (c *Client) RenameServerCtx(ctx context.Context, name string) (bool, error) {
+	return c.sendServerPutRequest(ctx, "/name", map[string]string{"name": name})
+}
+
+// EnsureServerName renames the server and reads the server info back to confirm the new name was applied
+func (c *Client) EnsureServerName(ctx context.Context, name string) (ServerResponse, error) {
+	if _, err := c.RenameServerCtx(ctx, name); err != nil {
+		return ServerResponse{}, err
+	}
+
+	server, err := c.GetServerInfoCtx(ctx)
+	if err != nil {
+		return ServerResponse{}, err
+	}
+	if server.Name != name {
+		return server, fmt.Errorf("server name is %q after renaming it to %q", server.Name, name)
+	}
+	return server, nil
 }
 
 func (c *Client) CheckMetrics() (result MetricsResponse, err error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	return c.CheckMetricsCtx(context.Background())
+}
+
+func (c *Client) CheckMetricsCtx(ctx context.Context) (result MetricsResponse, err error) {
+	ctx, cancel := withTimeout(ctx, c.Timeouts.get(c.Timeouts.Metrics, defaultMetricsTimeout))
 	defer cancel()
 
-	resp, err := c.MakeRequest(ctx, "GET", "/metrics/enabled", map[string]string{"content-type": contentTypeJSON}, nil)
+	status, data, err := c.fetch(ctx, "GET", "/metrics/enabled", nil, nil)
 	if err != nil {
 		return MetricsResponse{}, err
 	}
+	if status == http.StatusNoContent {
+		return MetricsResponse{}, nil
+	}
 
-	err = parseJSONFromReader(resp.Body, &result)
+	err = parseJSON(data, &result)
 	return
 }
 
-func (c *Client) ChangeMetrics(flag bool) (bool, error) {
-	return c.sendPutRequest("/metrics/enabled", map[string]bool{"metricsEnabled": flag})
+// ChangeMetrics enables or disables metrics sharing and returns the resulting state
+func (c *Client) ChangeMetrics(flag bool) (MetricsResponse, error) {
+	return c.ChangeMetricsCtx(context.Background(), flag)
+}
+
+func (c *Client) ChangeMetricsCtx(ctx context.Context, flag bool) (MetricsResponse, error) {
+	var echoed *MetricsResponse
+	if _, err := c.sendPutRequestDecode(ctx, "/metrics/enabled", map[string]bool{"metricsEnabled": flag}, &echoed); err != nil {
+		return MetricsResponse{}, err
+	}
+	c.invalidateServerInfoCache()
+	if echoed != nil {
+		return *echoed, nil
+	}
+
+	// The server answered 204 No Content, so read the state back
+	return c.CheckMetricsCtx(ctx)
+}
+
+// EnsureMetrics enables or disables metrics sharing only if the current state differs from desired,
+// and reports whether it made a change
+func (c *Client) EnsureMetrics(ctx context.Context, desired bool) (changed bool, err error) {
+	current, err := c.CheckMetricsCtx(ctx)
+	if err != nil {
+		return false, err
+	}
+	if current.MetricsEnabled == desired {
+		return false, nil
+	}
+
+	state, err := c.ChangeMetricsCtx(ctx, desired)
+	if err != nil {
+		return false, err
+	}
+	if state.MetricsEnabled != desired {
+		return true, fmt.Errorf("server reports metricsEnabled=%t after setting it to %t", state.MetricsEnabled, desired)
+	}
+	return true, nil
 }
 
 func (c *Client) ChangeDefaultPort(port int) (bool, error) {
-	return c.sendPutRequest("/server/port-for-new-access-keys", map[string]int{"port": port})
+	return c.ChangeDefaultPortCtx(context.Background(), port)
+}
+
+// ChangeDefaultPortCtx changes the port of new access keys.
+// It returns ErrPortConflict if an existing key already uses the port.
+func (c *Client) ChangeDefaultPortCtx(ctx context.Context, port int) (bool, error) {
+	if err := validatePort(port); err != nil {
+		return false, err
+	}
+
+	ok, err := c.sendServerPutRequest(ctx, "/server/port-for-new-access-keys", map[string]int{"port": port})
+	return ok, wrapPortConflict(err)
 }
 
 func (c *Client) SetDataLimitAllKeys(limit int64) (bool, error) {
-	return c.sendPutRequest("/server/access-key-data-limit", map[string]map[string]int64{"limit": {"bytes": limit}})
+	return c.SetDataLimitAllKeysCtx(context.Background(), limit)
+}
+
+func (c *Client) SetDataLimitAllKeysCtx(ctx context.Context, limit int64) (bool, error) {
+	return c.sendServerPutRequest(ctx, "/server/access-key-data-limit", map[string]map[string]int64{"limit": {"bytes": limit}})
 }
 
 func (c *Client) DeleteAllDataLimits() (bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	return c.DeleteAllDataLimitsCtx(context.Background())
+}
 
-	resp, err := c.MakeRequest(ctx, "DELETE", "/server/access-key-data-limit", map[string]string{}, nil)
-	if err != nil {
-		return false, fmt.Errorf("failed to delete all data limits: %w", err)
+func (c *Client) DeleteAllDataLimitsCtx(ctx context.Context) (bool, error) {
+	ok, err := c.sendDeleteRequest(ctx, "/server/access-key-data-limit")
+	if ok {
+		c.invalidateServerInfoCache()
 	}
+	return ok, err
+}
 
-	if resp.StatusCode == http.StatusNoContent {
-		return true, nil
-	}
+func (c *Client) CreateAccessKey() (result AccessKey, err error) {
+	return c.CreateAccessKeyCtx(context.Background())
+}
 
-	return false, err
+func (c *Client) CreateAccessKeyCtx(ctx context.Context) (result AccessKey, err error) {
+	return c.CreateAccessKeyWithParamsCtx(ctx, AccessKeyParams{})
 }
 
-func (c *Client) CreateAccessKey() (result AccessKey, err error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// CreateAccessKeyWithMethod creates a new access key using the given cipher method
+func (c *Client) CreateAccessKeyWithMethod(method string) (result AccessKey, err error) {
+	return c.CreateAccessKeyWithMethodCtx(context.Background(), method)
+}
+
+func (c *Client) CreateAccessKeyWithMethodCtx(ctx context.Context, method string) (result AccessKey, err error) {
+	return c.CreateAccessKeyWithParamsCtx(ctx, AccessKeyParams{Method: method})
+}
+
+// CreateAccessKeyWithParams creates a new access key with the given settings in a single request.
+// A key with params.Id set is created with PUT /access-keys/{id}, as by CreateAccessKeyWithID.
+func (c *Client) CreateAccessKeyWithParams(params AccessKeyParams) (result AccessKey, err error) {
+	return c.CreateAccessKeyWithParamsCtx(context.Background(), params)
+}
+
+func (c *Client) CreateAccessKeyWithParamsCtx(ctx context.Context, params AccessKeyParams) (result AccessKey, err error) {
+	if params.Id != "" {
+		return c.CreateAccessKeyWithIDCtx(ctx, params.Id, params)
+	}
+	params = c.withKeyDefaults(params)
+
+	data, err := params.request()
+	if err != nil {
+		return result, err
+	}
+
+	ctx, cancel := withTimeout(ctx, c.Timeouts.get(c.Timeouts.CreateKey, defaultCreateKeyTimeout))
 	defer cancel()
 
-	data := map[string]string{"method": "aes-192-gcm"}
 	byteData, err := json.Marshal(data)
+	if err != nil {
+		return result, fmt.Errorf("failed to marshal data: %w", err)
+	}
 
-	resp, err := c.MakeRequest(ctx, "POST", "/access-keys", map[string]string{"content-type": contentTypeJSON}, bytes.NewBuffer(byteData))
+	_, body, err := c.fetch(ctx, "POST", "/access-keys", jsonHeader, bytes.NewBuffer(byteData))
 	if err != nil {
 		return result, err
 	}
+	c.invalidateAccessKeysCache()
 
-	err = parseJSONFromReader(resp.Body, &result)
-	return
+	err = parseJSON(body, &result)
+	if err != nil {
+		return result, err
+	}
+	c.recordKeyCreation(result.Id)
+
+	if params.DataLimitBytes != nil {
+		return c.ensureDataLimit(ctx, result, *params.DataLimitBytes)
+	}
+	return result, nil
+}
+
+// withKeyDefaults fills the name and method of params from DefaultKeyName and DefaultMethod
+func (c *Client) withKeyDefaults(params AccessKeyParams) AccessKeyParams {
+	if params.Name == "" && c.DefaultKeyName != "" {
+		params.Name = c.defaultKeyName()
+	}
+	if params.Method == "" {
+		params.Method = c.DefaultMethod
+	}
+	return params
+}
+
+func (c *Client) defaultKeyName() string {
+	if !strings.Contains(c.DefaultKeyName, "%d") {
+		return c.DefaultKeyName
+	}
+	n := c.keyCounter.Add(1)
+	return strings.ReplaceAll(c.DefaultKeyName, "%d", strconv.FormatInt(n, 10))
+}
+
+// ensureDataLimit reads back the limit of a new key and sets it explicitly if the server
+// ignored the one sent on creation. If that fails too, the key is deleted, so that no
+// unlimited key is handed out.
+func (c *Client) ensureDataLimit(ctx context.Context, key AccessKey, limit int64) (AccessKey, error) {
+	if key.DataLimit == nil {
+		fetched, err := c.FetchAccessKey(ctx, key.Id)
+		if err == nil {
+			key = fetched
+		}
+	}
+	if key.DataLimit != nil && key.DataLimit.Bytes == limit {
+		return key, nil
+	}
+
+	if _, err := c.SetDataLimitAccessKeyByIDCtx(ctx, key.Id, limit); err != nil {
+		if _, deleteErr := c.DeleteAccessKeyCtx(context.WithoutCancel(ctx), key.Id); deleteErr != nil {
+			return AccessKey{}, errors.Join(
+				fmt.Errorf("failed to set data limit of new access key %s: %w", key.Id, err),
+				fmt.Errorf("failed to delete it: %w", deleteErr),
+			)
+		}
+		return AccessKey{}, fmt.Errorf("failed to set data limit of new access key, key deleted: %w", err)
+	}
+	key.DataLimit = &DataLimit{Bytes: limit}
+	return key, nil
 }
 
 func (c *Client) GetListAccessKeys() (result AccessKeysResponse, err error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	return c.GetListAccessKeysCtx(context.Background())
+}
+
+func (c *Client) GetListAccessKeysCtx(ctx context.Context) (result AccessKeysResponse, err error) {
+	ctx, cancel := withTimeout(ctx, c.Timeouts.get(c.Timeouts.ListKeys, defaultListKeysTimeout))
 	defer cancel()
-	if ctx.Err() != nil {
-		return result, fmt.Errorf("request timed out: %w", ctx.Err())
-	}
 
-	resp, err := c.MakeRequest(ctx, "GET", "/access-keys", map[string]string{"content-type": contentTypeJSON}, nil)
+	_, data, err := c.fetch(ctx, "GET", "/access-keys", nil, nil)
 	if err != nil {
 		return result, err
 	}
 
-	err = parseJSONFromReader(resp.Body, &result)
+	err = parseJSON(data, &result)
 	return
 }
 
+// FetchAccessKey loads a single access key from the server, bypassing the local cache.
+// It returns ErrKeyNotFound if the server does not know the key.
+func (c *Client) FetchAccessKey(ctx context.Context, id string) (result AccessKey, err error) {
+	ctx, cancel := withTimeout(ctx, c.Timeouts.get(c.Timeouts.ListKeys, defaultListKeysTimeout))
+	defer cancel()
+
+	_, data, err := c.fetch(ctx, "GET", accessKeyPath(id), nil, nil)
+	if err != nil {
+		return result, wrapKeyNotFound(err)
+	}
+
+	err = parseJSON(data, &result)
+	return
+}
+
+// IterateAccessKeys calls fn for every access key while decoding the list incrementally,
+// so the whole list is never held in memory. Iteration stops at the first error returned by fn.
+func (c *Client) IterateAccessKeys(ctx context.Context, fn func(AccessKey) error) error {
+	ctx, cancel := withTimeout(ctx, c.Timeouts.get(c.Timeouts.ListKeys, defaultListKeysTimeout))
+	defer cancel()
+
+	resp, err := c.MakeRequest(ctx, "GET", "/access-keys", nil, nil)
+	if err != nil {
+		return err
+	}
+	defer drainAndClose(resp.Body)
+
+	decoder := json.NewDecoder(resp.Body)
+	if err := expectDelim(decoder, '{'); err != nil {
+		return err
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		if token != "accessKeys" {
+			var skip json.RawMessage
+			if err := decoder.Decode(&skip); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := expectDelim(decoder, '['); err != nil {
+			return err
+		}
+		for decoder.More() {
+			var key AccessKey
+			if err := decoder.Decode(&key); err != nil {
+				return err
+			}
+			if err := fn(key); err != nil {
+				return err
+			}
+		}
+		if err := expectDelim(decoder, ']'); err != nil {
+			return err
+		}
+	}
+	return expectDelim(decoder, '}')
+}
+
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("unexpected token %v, expected %v", token, delim)
+	}
+	return nil
+}
+
 func (c *Client) DeleteAccessKey(id string) (bool, error) {
-	return c.sendDeleteRequest("/access-keys/" + id)
+	return c.DeleteAccessKeyCtx(context.Background(), id)
+}
+
+// DeleteAccessKeyCtx deletes a key.
+// It returns ErrKeyNotFound if the server does not know the key.
+func (c *Client) DeleteAccessKeyCtx(ctx context.Context, id string) (bool, error) {
+	ok, err := c.sendDeleteRequest(ctx, accessKeyPath(id))
+	if ok {
+		c.invalidateAccessKeysCache()
+		c.forgetKeyCreation(id)
+	}
+	return ok, wrapKeyNotFound(err)
+}
+
+// Deprecated: access key ids are strings, use RenameAccessKeyByID.
+func (c *Client) RenameAccessKey(id int, name string) (AccessKey, error) {
+	return c.RenameAccessKeyByID(strconv.Itoa(id), name)
+}
+
+// RenameAccessKeyByID renames a key and returns it with the new name
+func (c *Client) RenameAccessKeyByID(id string, name string) (AccessKey, error) {
+	return c.RenameAccessKeyByIDCtx(context.Background(), id, name)
 }
 
-func (c *Client) RenameAccessKey(id int, name string) (bool, error) {
-	return c.sendPutRequest(fmt.Sprintf("/access-keys/%d/name", id), map[string]string{"name": name})
+// RenameAccessKeyByIDCtx renames a key and returns it with the new name.
+// It returns ErrKeyNotFound if the server does not know the key. If the renamed key cannot be
+// fetched afterwards, only its id and new name are set.
+func (c *Client) RenameAccessKeyByIDCtx(ctx context.Context, id string, name string) (AccessKey, error) {
+	if _, err := c.sendPutRequest(ctx, accessKeyPath(id)+"/name", map[string]string{"name": name}); err != nil {
+		return AccessKey{}, wrapKeyNotFound(err)
+	}
+
+	// Update the cached key rather than reloading the whole list
+	if key, ok := c.cachedAccessKey(id); ok {
+		key.Name = name
+		c.updateCachedAccessKey(key)
+		return key, nil
+	}
+	c.invalidateAccessKeysCache()
+
+	key, err := c.FetchAccessKey(ctx, id)
+	if err != nil {
+		// The rename was applied, so it is not reported as failed when the key cannot be read back,
+		// e.g. on servers without GET /access-keys/{id}
+		return AccessKey{Id: id, Name: name}, nil
+	}
+	return key, nil
 }
 
+// Deprecated: access key ids are strings, use SetDataLimitAccessKeyByID.
 func (c *Client) SetDataLimitAccessKey(id int, limit int64) (bool, error) {
-	return c.sendPutRequest(fmt.Sprintf("/access-keys/%d/data-limit", id), map[string]map[string]int64{"limit": {"bytes": limit}})
+	return c.SetDataLimitAccessKeyByID(strconv.Itoa(id), limit)
+}
+
+func (c *Client) SetDataLimitAccessKeyByID(id string, limit int64) (bool, error) {
+	return c.SetDataLimitAccessKeyByIDCtx(context.Background(), id, limit)
 }
 
+// SetDataLimitAccessKeyByIDCtx sets the data limit of a single key.
+// It returns ErrKeyNotFound if the server does not know the key.
+func (c *Client) SetDataLimitAccessKeyByIDCtx(ctx context.Context, id string, limit int64) (bool, error) {
+	ok, err := c.sendPutRequest(ctx, accessKeyPath(id)+"/data-limit", map[string]map[string]int64{"limit": {"bytes": limit}})
+	if ok {
+		c.invalidateAccessKeysCache()
+	}
+	return ok, wrapKeyNotFound(err)
+}
+
+// SetDataLimitAccessKeyHuman sets the data limit of a single key from a size such as "5GB" or "500MiB",
+// see ParseBytes for the accepted formats
+func (c *Client) SetDataLimitAccessKeyHuman(id string, limit string) (bool, error) {
+	return c.SetDataLimitAccessKeyHumanCtx(context.Background(), id, limit)
+}
+
+func (c *Client) SetDataLimitAccessKeyHumanCtx(ctx context.Context, id string, limit string) (bool, error) {
+	limitBytes, err := ParseBytes(limit)
+	if err != nil {
+		return false, err
+	}
+	return c.SetDataLimitAccessKeyByIDCtx(ctx, id, limitBytes)
+}
+
+// Deprecated: access key ids are strings, use DeleteDataLimitAccessKeyByID.
 func (c *Client) DeleteDataLimitAccessKey(id int) (bool, error) {
-	return c.sendDeleteRequest(fmt.Sprintf("/access-keys/%d/data-limit", id))
+	return c.DeleteDataLimitAccessKeyByID(strconv.Itoa(id))
+}
+
+func (c *Client) DeleteDataLimitAccessKeyByID(id string) (bool, error) {
+	return c.DeleteDataLimitAccessKeyByIDCtx(context.Background(), id)
+}
+
+// DeleteDataLimitAccessKeyByIDCtx removes the data limit of a single key.
+// It returns ErrKeyNotFound if the server does not know the key.
+func (c *Client) DeleteDataLimitAccessKeyByIDCtx(ctx context.Context, id string) (bool, error) {
+	ok, err := c.sendDeleteRequest(ctx, accessKeyPath(id)+"/data-limit")
+	if ok {
+		c.invalidateAccessKeysCache()
+	}
+	return ok, wrapKeyNotFound(err)
 }
 
 func (c *Client) DataTransferredAccessKey() (result TransferData, err error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	return c.DataTransferredAccessKeyCtx(context.Background())
+}
+
+// DataTransferredAccessKeyCtx returns the bytes transferred by each key.
+// The 30s default (Timeouts.TransferData) applies only when ctx has no deadline; cancelling ctx aborts the request.
+func (c *Client) DataTransferredAccessKeyCtx(ctx context.Context) (result TransferData, err error) {
+	ctx, cancel := withTimeout(ctx, c.Timeouts.get(c.Timeouts.TransferData, defaultTransferDataTimeout))
 	defer cancel()
 
-	resp, err := c.MakeRequest(ctx, "GET", "/metrics/transfer", map[string]string{"content-type": contentTypeJSON}, nil)
+	_, data, err := c.fetch(ctx, "GET", "/metrics/transfer", nil, nil)
 	if err != nil {
 		return result, err
 	}
 
-	err = parseJSONFromReader(resp.Body, &result)
+	err = parseJSON(data, &result)
 	return
 }
 
+// accessKeyPath returns the endpoint of a single access key
+func accessKeyPath(id string) string {
+	return "/access-keys/" + url.PathEscape(id)
+}
+
+// SupportedMethods returns the cipher methods accepted by CreateAccessKeyWithMethod
+func SupportedMethods() []string {
+	methods := make([]string, len(supportedMethods))
+	copy(methods, supportedMethods)
+	return methods
+}
+
+func validatePort(port int) error {
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("port %d out of range", port)
+	}
+	return nil
+}
+
+func validateMethod(method string) error {
+	for _, m := range supportedMethods {
+		if m == method {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q", ErrUnsupportedMethod, method)
+}
+
 // Functions for sending PUT and DELETE requests
-func (c *Client) sendPutRequest(endpoint string, data interface{}) (bool, error) {
+func (c *Client) sendPutRequest(ctx context.Context, endpoint string, data interface{}) (bool, error) {
+	return c.sendPutRequestDecode(ctx, endpoint, data, nil)
+}
+
+// sendServerPutRequest sends a PUT request changing a server setting and drops the cached server info
+func (c *Client) sendServerPutRequest(ctx context.Context, endpoint string, data interface{}) (bool, error) {
+	ok, err := c.sendPutRequest(ctx, endpoint, data)
+	if ok {
+		c.invalidateServerInfoCache()
+	}
+	return ok, err
+}
+
+// sendPutRequestDecode sends a PUT request and decodes the response body into v,
+// if v is not nil and the server sent a body
+func (c *Client) sendPutRequestDecode(ctx context.Context, endpoint string, data interface{}, v interface{}) (bool, error) {
 	byteData, err := json.Marshal(data)
 	if err != nil {
 		return false, fmt.Errorf("failed to marshal data: %w", err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := withTimeout(ctx, c.Timeouts.get(c.Timeouts.ModifyRequests, defaultModifyRequestsTimeout))
 	defer cancel()
 
-	resp, err := c.MakeRequest(ctx, http.MethodPut, endpoint, jsonHeader, bytes.NewBuffer(byteData))
+	status, body, err := c.fetch(ctx, http.MethodPut, endpoint, jsonHeader, bytes.NewBuffer(byteData))
 	if err != nil {
 		return false, fmt.Errorf("failed to send PUT request: %w", err)
 	}
 
-	return resp.StatusCode == http.StatusOK, nil
+	// The Outline server answers most PUT requests with 204 No Content
+	switch status {
+	case http.StatusOK, http.StatusCreated:
+		if v != nil {
+			if err := parseJSON(body, v); err != nil {
+				return false, fmt.Errorf("failed to decode PUT response: %w", err)
+			}
+		}
+	case http.StatusNoContent:
+	default:
+		return false, fmt.Errorf("unexpected status %d for PUT %s", status, endpoint)
+	}
+
+	return true, nil
 }
 
-func (c *Client) sendDeleteRequest(endpoint string) (bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (c *Client) sendDeleteRequest(ctx context.Context, endpoint string) (bool, error) {
+	ctx, cancel := withTimeout(ctx, c.Timeouts.get(c.Timeouts.ModifyRequests, defaultModifyRequestsTimeout))
 	defer cancel()
 
-	resp, err := c.MakeRequest(ctx, http.MethodDelete, endpoint, jsonHeader, nil)
+	status, _, err := c.fetch(ctx, http.MethodDelete, endpoint, nil, nil)
 	if err != nil {
 		return false, fmt.Errorf("failed to send DELETE request: %w", err)
 	}
 
-	return resp.StatusCode == http.StatusNoContent, nil
+	if status != http.StatusOK && status != http.StatusNoContent {
+		return false, fmt.Errorf("unexpected status %d for DELETE %s", status, endpoint)
+	}
+
+	return true, nil
 }
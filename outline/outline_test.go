@@ -0,0 +1,189 @@
+package outline_lib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestApiUrlTrailingSlash(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Header().Set("Content-Type", contentTypeJSON)
+		w.Write([]byte(`{"name":"test","serverId":"1"}`))
+	}))
+	defer srv.Close()
+
+	apiURL := srv.URL + "/secret"
+	for _, u := range []string{apiURL, apiURL + "/"} {
+		if _, err := NewClient(u).GetServerInfo(); err != nil {
+			t.Fatalf("GetServerInfo with ApiUrl %q: %v", u, err)
+		}
+	}
+
+	if len(paths) != 2 {
+		t.Fatalf("got %d requests, want 2", len(paths))
+	}
+	for _, path := range paths {
+		if path != "/secret/server" {
+			t.Errorf("requested %q, want %q", path, "/secret/server")
+		}
+	}
+}
+
+func TestSetAuthTokenWhileRequesting(t *testing.T) {
+	var mu sync.Mutex
+	seen := make(map[string]bool)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen[r.Header.Get("Authorization")] = true
+		mu.Unlock()
+		w.Write([]byte(`{"name":"test","serverId":"1"}`))
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL)
+	c.SetAuthToken("first")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if _, err := c.GetServerInfo(); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		c.SetAuthToken("token" + strconv.Itoa(i))
+	}
+	wg.Wait()
+
+	if _, err := c.GetServerInfo(); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !seen["Bearer token19"] {
+		t.Errorf("the last token was not sent, saw %v", seen)
+	}
+	for header := range seen {
+		if !strings.HasPrefix(header, "Bearer ") {
+			t.Errorf("unexpected Authorization header %q", header)
+		}
+	}
+}
+
+func TestDeleteAllDataLimitsAccepts200And204(t *testing.T) {
+	for _, status := range []int{http.StatusOK, http.StatusNoContent} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodDelete || r.URL.Path != "/server/access-key-data-limit" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(status)
+		}))
+
+		if ok, err := NewClient(srv.URL).DeleteAllDataLimits(); !ok || err != nil {
+			t.Errorf("status %d: got %v, %v", status, ok, err)
+		}
+		srv.Close()
+	}
+}
+
+func TestCertSha256Pinning(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name":"test","serverId":"1"}`))
+	}))
+	defer srv.Close()
+
+	sum := sha256.Sum256(srv.Certificate().Raw)
+	fingerprint := hex.EncodeToString(sum[:])
+	var colons []string
+	for i := 0; i < len(fingerprint); i += 2 {
+		colons = append(colons, strings.ToUpper(fingerprint[i:i+2]))
+	}
+
+	for _, pin := range []string{fingerprint, strings.ToUpper(fingerprint), strings.Join(colons, ":")} {
+		if _, err := NewClientWithCert(srv.URL, pin).GetServerInfo(); err != nil {
+			t.Errorf("pin %q: %v", pin, err)
+		}
+	}
+
+	wrong := strings.Repeat("00", sha256.Size)
+	_, err := NewClientWithCert(srv.URL, wrong).GetServerInfo()
+	var handshakeErr *TLSHandshakeError
+	if !errors.Is(err, ErrCertificateMismatch) || !errors.As(err, &handshakeErr) {
+		t.Errorf("wrong pin: got %v, want ErrCertificateMismatch in a *TLSHandshakeError", err)
+	}
+}
+
+func TestNewClientFromConfigValidatesCertSha256(t *testing.T) {
+	valid := strings.Repeat("ab", sha256.Size)
+	tests := []struct {
+		certSha256 string
+		wantErr    bool
+	}{
+		{"", false},
+		{valid, false},
+		{strings.ToUpper(valid), false},
+		{"AB:" + strings.Repeat("AB:", sha256.Size-2) + "AB", false},
+		{valid[:62], true},
+		{valid + "ab", true},
+		{strings.Repeat("zz", sha256.Size), true},
+	}
+
+	for _, tt := range tests {
+		config := `{"apiUrl":"https://127.0.0.1:1234/secret","certSha256":"` + tt.certSha256 + `"}`
+		_, err := NewClientFromConfig(config)
+		if tt.wantErr != (err != nil) {
+			t.Errorf("certSha256 %q: got error %v, want error %v", tt.certSha256, err, tt.wantErr)
+		}
+		if tt.wantErr && !errors.Is(err, ErrInvalidCertSha256) {
+			t.Errorf("certSha256 %q: got %v, want ErrInvalidCertSha256", tt.certSha256, err)
+		}
+	}
+}
+
+func TestCreateAccessKeyWithParamsId(t *testing.T) {
+	var method, path string
+	var body createAccessKeyRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		json.NewDecoder(r.Body).Decode(&body)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":"migrated-1","name":"alice","port":8388,"method":"aes-192-gcm"}`))
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL)
+	key, err := c.CreateAccessKeyWithParams(AccessKeyParams{Id: "migrated-1", Name: "alice", Port: 8388})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if method != http.MethodPut || path != "/access-keys/migrated-1" {
+		t.Errorf("sent %s %s, want PUT /access-keys/migrated-1", method, path)
+	}
+	if body.Name != "alice" || body.Port != 8388 {
+		t.Errorf("sent %+v, want the name and port", body)
+	}
+	if key.Id != "migrated-1" {
+		t.Errorf("got key %q, want migrated-1", key.Id)
+	}
+
+	if _, err := c.CreateManyAccessKeys(2, AccessKeyParams{Id: "migrated-1"}); err == nil {
+		t.Error("CreateManyAccessKeys accepted one id for 2 keys")
+	}
+}
@@ -0,0 +1,494 @@
+package outline_lib
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+// A minimal QR code encoder for access URLs: byte mode, error correction level M, versions 1 to 40.
+
+// ErrNoAccessURL is returned when a QR code is requested for a key without an accessUrl
+var ErrNoAccessURL = errors.New("access key has no access url")
+
+const (
+	qrModuleSize = 8 // pixels per module in the PNG
+	qrQuietZone  = 4 // light modules around the symbol
+)
+
+// qrBlocksM holds, for each version, the error correction blocks of level M as
+// (block count, total codewords, data codewords) for up to two groups of blocks
+var qrBlocksM = [41][]int{
+	nil,
+	{1, 26, 16}, {1, 44, 28}, {1, 70, 44}, {2, 50, 32}, {2, 67, 43},
+	{4, 43, 27}, {4, 49, 31}, {2, 60, 38, 2, 61, 39}, {3, 58, 36, 2, 59, 37}, {4, 69, 43, 1, 70, 44},
+	{1, 80, 50, 4, 81, 51}, {6, 58, 36, 2, 59, 37}, {8, 59, 37, 1, 60, 38}, {4, 64, 40, 5, 65, 41}, {5, 65, 41, 5, 66, 42},
+	{7, 73, 45, 3, 74, 46}, {10, 74, 46, 1, 75, 47}, {9, 69, 43, 4, 70, 44}, {3, 70, 44, 11, 71, 45}, {3, 67, 41, 13, 68, 42},
+	{17, 68, 42}, {17, 74, 46}, {4, 75, 47, 14, 76, 48}, {6, 73, 45, 14, 74, 46}, {8, 75, 47, 13, 76, 48},
+	{19, 74, 46, 4, 75, 47}, {22, 73, 45, 3, 74, 46}, {3, 73, 45, 23, 74, 46}, {21, 73, 45, 7, 74, 46}, {19, 75, 47, 10, 76, 48},
+	{2, 74, 46, 29, 75, 47}, {10, 74, 46, 23, 75, 47}, {14, 74, 46, 21, 75, 47}, {14, 74, 46, 23, 75, 47}, {12, 75, 47, 26, 76, 48},
+	{6, 75, 47, 34, 76, 48}, {29, 74, 46, 14, 75, 47}, {13, 74, 46, 32, 75, 47}, {40, 75, 47, 7, 76, 48}, {18, 75, 47, 31, 76, 48},
+}
+
+// QRCode returns a PNG image of a QR code encoding the accessUrl of the key
+func (k AccessKey) QRCode() ([]byte, error) {
+	if k.AccessUrl == "" {
+		return nil, ErrNoAccessURL
+	}
+
+	qr, err := encodeQR([]byte(k.AccessUrl))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, qr.image()); err != nil {
+		return nil, fmt.Errorf("failed to encode png: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// QRCodeDataURI returns the QR code of the key as a data:image/png;base64 URI
+func (k AccessKey) QRCodeDataURI() (string, error) {
+	img, err := k.QRCode()
+	if err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(img), nil
+}
+
+type qrCode struct {
+	version int
+	size    int
+	modules [][]bool // [y][x], true is dark
+	isFunc  [][]bool // modules of function patterns, which are not masked
+}
+
+func encodeQR(data []byte) (*qrCode, error) {
+	version := 0
+	for v := 1; v <= 40; v++ {
+		if qrHeaderBits(v)+8*len(data) <= 8*qrDataCodewords(v) {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, fmt.Errorf("data of %d bytes is too long for a qr code", len(data))
+	}
+
+	qr := &qrCode{version: version, size: 17 + 4*version}
+	qr.modules = make([][]bool, qr.size)
+	qr.isFunc = make([][]bool, qr.size)
+	for y := range qr.modules {
+		qr.modules[y] = make([]bool, qr.size)
+		qr.isFunc[y] = make([]bool, qr.size)
+	}
+
+	qr.drawFunctionPatterns()
+	qr.drawCodewords(qrAddErrorCorrection(version, qrDataBits(version, data)))
+
+	bestMask, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		qr.applyMask(mask)
+		qr.drawFormatBits(mask)
+		if penalty := qr.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			bestMask, bestPenalty = mask, penalty
+		}
+		qr.applyMask(mask) // masking twice restores the modules
+	}
+	qr.applyMask(bestMask)
+	qr.drawFormatBits(bestMask)
+	return qr, nil
+}
+
+func qrHeaderBits(version int) int {
+	if version <= 9 {
+		return 4 + 8
+	}
+	return 4 + 16
+}
+
+func qrDataCodewords(version int) int {
+	blocks := qrBlocksM[version]
+	total := 0
+	for i := 0; i < len(blocks); i += 3 {
+		total += blocks[i] * blocks[i+2]
+	}
+	return total
+}
+
+// qrDataBits returns the padded data codewords: byte mode indicator, length, data, terminator and padding
+func qrDataBits(version int, data []byte) []byte {
+	capacity := qrDataCodewords(version)
+	var bits []bool
+	appendBits := func(value, n int) {
+		for i := n - 1; i >= 0; i-- {
+			bits = append(bits, (value>>i)&1 != 0)
+		}
+	}
+
+	appendBits(0b0100, 4)
+	appendBits(len(data), qrHeaderBits(version)-4)
+	for _, b := range data {
+		appendBits(int(b), 8)
+	}
+	appendBits(0, min(4, capacity*8-len(bits)))
+	appendBits(0, (8-len(bits)%8)%8)
+
+	codewords := make([]byte, 0, capacity)
+	for i := 0; i < len(bits); i += 8 {
+		var b byte
+		for j := 0; j < 8; j++ {
+			if bits[i+j] {
+				b |= 1 << (7 - j)
+			}
+		}
+		codewords = append(codewords, b)
+	}
+	for pad := byte(0xEC); len(codewords) < capacity; pad ^= 0xEC ^ 0x11 {
+		codewords = append(codewords, pad)
+	}
+	return codewords
+}
+
+// qrAddErrorCorrection splits the data into blocks, appends their Reed-Solomon codewords and interleaves them
+func qrAddErrorCorrection(version int, data []byte) []byte {
+	layout := qrBlocksM[version]
+	eccLen := layout[1] - layout[2]
+	divisor := rsDivisor(eccLen)
+
+	var dataBlocks, eccBlocks [][]byte
+	for i := 0; i < len(layout); i += 3 {
+		for n := 0; n < layout[i]; n++ {
+			block := data[:layout[i+2]]
+			data = data[layout[i+2]:]
+			dataBlocks = append(dataBlocks, block)
+			eccBlocks = append(eccBlocks, rsRemainder(block, divisor))
+		}
+	}
+
+	var result []byte
+	for i := 0; i < len(dataBlocks[len(dataBlocks)-1]); i++ {
+		for _, block := range dataBlocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < eccLen; i++ {
+		for _, block := range eccBlocks {
+			result = append(result, block[i])
+		}
+	}
+	return result
+}
+
+// rsDivisor returns the Reed-Solomon generator polynomial of the given degree, highest coefficient omitted
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMul(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMul(root, 0x02)
+	}
+	return result
+}
+
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, coef := range divisor {
+			result[i] ^= gfMul(coef, factor)
+		}
+	}
+	return result
+}
+
+// gfMul multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1
+func gfMul(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int(y>>i&1) * int(x)
+	}
+	return byte(z)
+}
+
+func (qr *qrCode) setFunc(x, y int, dark bool) {
+	qr.modules[y][x] = dark
+	qr.isFunc[y][x] = true
+}
+
+func (qr *qrCode) drawFunctionPatterns() {
+	for i := 0; i < qr.size; i++ {
+		qr.setFunc(6, i, i%2 == 0)
+		qr.setFunc(i, 6, i%2 == 0)
+	}
+
+	qr.drawFinder(3, 3)
+	qr.drawFinder(qr.size-4, 3)
+	qr.drawFinder(3, qr.size-4)
+
+	positions := qr.alignmentPositions()
+	n := len(positions)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			if (i == 0 && j == 0) || (i == 0 && j == n-1) || (i == n-1 && j == 0) {
+				continue // overlaps a finder
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					qr.setFunc(positions[i]+dx, positions[j]+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	qr.drawFormatBits(0) // reserves the area, redrawn once the mask is chosen
+	qr.drawVersion()
+}
+
+// drawFinder draws a finder pattern and its separator centered on (x, y)
+func (qr *qrCode) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx >= 0 && xx < qr.size && yy >= 0 && yy < qr.size {
+				dist := max(abs(dx), abs(dy))
+				qr.setFunc(xx, yy, dist != 2 && dist != 4)
+			}
+		}
+	}
+}
+
+func (qr *qrCode) alignmentPositions() []int {
+	if qr.version == 1 {
+		return nil
+	}
+	n := qr.version/7 + 2
+	step := 26
+	if qr.version != 32 {
+		step = (qr.version*4 + n*2 + 1) / (n*2 - 2) * 2
+	}
+
+	positions := make([]int, n)
+	positions[0] = 6
+	for i, pos := n-1, qr.size-7; i >= 1; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+	return positions
+}
+
+func (qr *qrCode) drawFormatBits(mask int) {
+	data := mask // level M is 00
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return bits>>i&1 != 0 }
+
+	for i := 0; i <= 5; i++ {
+		qr.setFunc(8, i, bit(i))
+	}
+	qr.setFunc(8, 7, bit(6))
+	qr.setFunc(8, 8, bit(7))
+	qr.setFunc(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		qr.setFunc(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		qr.setFunc(qr.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		qr.setFunc(8, qr.size-15+i, bit(i))
+	}
+	qr.setFunc(8, qr.size-8, true)
+}
+
+func (qr *qrCode) drawVersion() {
+	if qr.version < 7 {
+		return
+	}
+	rem := qr.version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	bits := qr.version<<12 | rem
+
+	for i := 0; i < 18; i++ {
+		dark := bits>>i&1 != 0
+		a, b := qr.size-11+i%3, i/3
+		qr.setFunc(a, b, dark)
+		qr.setFunc(b, a, dark)
+	}
+}
+
+// drawCodewords places the codewords in the two-module wide zigzag columns, right to left
+func (qr *qrCode) drawCodewords(codewords []byte) {
+	i := 0
+	for right := qr.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // skip the vertical timing pattern
+		}
+		for vert := 0; vert < qr.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = qr.size - 1 - vert
+				}
+				if !qr.isFunc[y][x] && i < len(codewords)*8 {
+					qr.modules[y][x] = codewords[i>>3]>>(7-i&7)&1 != 0
+					i++
+				}
+			}
+		}
+	}
+}
+
+func (qr *qrCode) applyMask(mask int) {
+	for y := 0; y < qr.size; y++ {
+		for x := 0; x < qr.size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !qr.isFunc[y][x] {
+				qr.modules[y][x] = !qr.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores the symbol with the four rules of the QR code specification, lower is better
+func (qr *qrCode) penalty() int {
+	result := 0
+	finderLike := []bool{true, false, true, true, true, false, true}
+
+	line := make([]bool, qr.size)
+	for _, vertical := range []bool{false, true} {
+		for a := 0; a < qr.size; a++ {
+			for b := 0; b < qr.size; b++ {
+				if vertical {
+					line[b] = qr.modules[b][a]
+				} else {
+					line[b] = qr.modules[a][b]
+				}
+			}
+
+			run := 1
+			for b := 1; b <= qr.size; b++ {
+				if b < qr.size && line[b] == line[b-1] {
+					run++
+					continue
+				}
+				if run >= 5 {
+					result += 3 + run - 5
+				}
+				run = 1
+			}
+
+			for b := 0; b+len(finderLike) <= qr.size; b++ {
+				if !matches(line[b:b+len(finderLike)], finderLike) {
+					continue
+				}
+				if lightRun(line, b-4, b) || lightRun(line, b+len(finderLike), b+len(finderLike)+4) {
+					result += 40
+				}
+			}
+		}
+	}
+
+	dark := 0
+	for y := 0; y < qr.size; y++ {
+		for x := 0; x < qr.size; x++ {
+			if qr.modules[y][x] {
+				dark++
+			}
+			if x+1 < qr.size && y+1 < qr.size {
+				c := qr.modules[y][x]
+				if c == qr.modules[y][x+1] && c == qr.modules[y+1][x] && c == qr.modules[y+1][x+1] {
+					result += 3
+				}
+			}
+		}
+	}
+	percent := dark * 100 / (qr.size * qr.size)
+	result += abs(percent-50) / 5 * 10
+	return result
+}
+
+func matches(line, pattern []bool) bool {
+	for i := range pattern {
+		if line[i] != pattern[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// lightRun reports whether line[from:to] is light, treating modules outside the symbol as light
+func lightRun(line []bool, from, to int) bool {
+	for i := from; i < to; i++ {
+		if i >= 0 && i < len(line) && line[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func (qr *qrCode) image() image.Image {
+	dim := (qr.size + 2*qrQuietZone) * qrModuleSize
+	img := image.NewPaletted(image.Rect(0, 0, dim, dim), color.Palette{color.White, color.Black})
+	for y := 0; y < qr.size; y++ {
+		for x := 0; x < qr.size; x++ {
+			if !qr.modules[y][x] {
+				continue
+			}
+			for py := 0; py < qrModuleSize; py++ {
+				row := ((y+qrQuietZone)*qrModuleSize + py) * img.Stride
+				for px := 0; px < qrModuleSize; px++ {
+					img.Pix[row+(x+qrQuietZone)*qrModuleSize+px] = 1
+				}
+			}
+		}
+	}
+	return img
+}
@@ -0,0 +1,66 @@
+package outline_lib
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+const defaultRetryBaseDelay = 200 * time.Millisecond
+
+// RetryPolicy controls how MakeRequest retries connection errors and 5xx responses.
+// The zero value disables retries. POST requests are only retried when RetryPOST is set,
+// because retrying CreateAccessKey may create duplicate keys.
+type RetryPolicy struct {
+	MaxAttempts int           // total number of attempts, including the first one
+	BaseDelay   time.Duration // delay before the first retry, doubled on each following one (200ms if zero)
+	RetryPOST   bool
+}
+
+func (p RetryPolicy) attempts(method string) int {
+	if p.MaxAttempts < 1 || (method == http.MethodPost && !p.RetryPOST) {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// wait sleeps before the next attempt and reports false if ctx is done
+// or its deadline leaves no room for another attempt
+func (p RetryPolicy) wait(ctx context.Context, attempt int) bool {
+	delay := p.BaseDelay
+	if delay <= 0 {
+		delay = defaultRetryBaseDelay
+	}
+	delay <<= attempt - 1
+
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= delay {
+		return false
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// errCreateRequest marks requests that could not be built, e.g. because of a malformed API URL
+var errCreateRequest = errors.New("failed to create request")
+
+// isRetryable reports whether err is a transient failure worth another attempt:
+// a 5xx response or a connection error, but not a rejected certificate or a request that cannot be built
+func isRetryable(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= 500
+	}
+	return !errors.Is(err, errCreateRequest) && !isCertificateError(err)
+}
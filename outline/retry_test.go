@@ -0,0 +1,123 @@
+package outline_lib
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		policy   RetryPolicy
+		statuses []int // replies in order, the last one repeats
+		wantErr  bool
+		wantReqs int64
+	}{
+		{"5xx retried", http.MethodGet, RetryPolicy{MaxAttempts: 3}, []int{503, 502, 200}, false, 3},
+		{"attempts exhausted", http.MethodGet, RetryPolicy{MaxAttempts: 2}, []int{500}, true, 2},
+		{"4xx not retried", http.MethodGet, RetryPolicy{MaxAttempts: 3}, []int{404}, true, 1},
+		{"zero policy", http.MethodGet, RetryPolicy{}, []int{503, 200}, true, 1},
+		{"POST not retried", http.MethodPost, RetryPolicy{MaxAttempts: 3}, []int{503, 200}, true, 1},
+		{"POST with RetryPOST", http.MethodPost, RetryPolicy{MaxAttempts: 3, RetryPOST: true}, []int{503, 200}, false, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reqs atomic.Int64
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(reqs.Add(1))
+				w.WriteHeader(tt.statuses[min(n, len(tt.statuses))-1])
+			}))
+			defer srv.Close()
+
+			c := NewClient(srv.URL)
+			c.RetryPolicy = tt.policy
+			c.RetryPolicy.BaseDelay = time.Millisecond
+			resp, err := c.MakeRequest(context.Background(), tt.method, "/server", nil, nil)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if tt.wantErr != (err != nil) {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if got := reqs.Load(); got != tt.wantReqs {
+				t.Errorf("got %d requests, want %d", got, tt.wantReqs)
+			}
+		})
+	}
+}
+
+func TestRetryNotForWrongCertificate(t *testing.T) {
+	var handshakes atomic.Int64
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		handshakes.Add(1)
+		return nil, nil
+	}}
+	srv.Config.ErrorLog = nil
+	srv.StartTLS()
+	defer srv.Close()
+
+	c := NewClientWithCert(srv.URL, "00")
+	c.RetryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+	if _, err := c.GetServerInfo(); !errors.Is(err, ErrCertificateMismatch) {
+		t.Fatalf("got %v, want ErrCertificateMismatch", err)
+	}
+	if got := handshakes.Load(); got != 1 {
+		t.Errorf("got %d handshakes, want 1", got)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	connErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want bool
+	}{
+		{"nil", context.Background(), nil, false},
+		{"5xx", context.Background(), &APIError{StatusCode: 503}, true},
+		{"4xx", context.Background(), &APIError{StatusCode: 409}, false},
+		{"connection error", context.Background(), fmt.Errorf("failed to execute request: %w", connErr), true},
+		{"canceled context", canceled, connErr, false},
+		{"certificate mismatch", context.Background(), &TLSHandshakeError{Err: fmt.Errorf("%w: got AA", ErrCertificateMismatch)}, false},
+		{"certificate verification", context.Background(), &tls.CertificateVerificationError{Err: errors.New("unknown authority")}, false},
+		{"request construction", context.Background(), fmt.Errorf("%w: bad url", errCreateRequest), false},
+	}
+
+	for _, tt := range tests {
+		if got := isRetryable(tt.ctx, tt.err); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRetryWaitBoundedByDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	start := time.Now()
+	if (RetryPolicy{BaseDelay: time.Hour}).wait(ctx, 1) {
+		t.Error("wait reported another attempt although the delay exceeds the deadline")
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("wait slept %v instead of giving up", elapsed)
+	}
+
+	if !(RetryPolicy{BaseDelay: time.Millisecond}).wait(ctx, 1) {
+		t.Error("wait gave up although the delay fits the deadline")
+	}
+}
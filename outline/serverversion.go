@@ -0,0 +1,137 @@
+package outline_lib
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SemVer is a semantic version such as 1.9.2 or 1.10.0-rc1
+type SemVer struct {
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease string
+}
+
+// ParseSemVer parses versions like "1.9.2", "v1.9" or "1.10.0-rc1+build"; missing minor and patch numbers are 0
+func ParseSemVer(s string) (SemVer, error) {
+	var v SemVer
+	rest := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	rest, _, _ = strings.Cut(rest, "+")
+	rest, v.Prerelease, _ = strings.Cut(rest, "-")
+
+	parts := strings.Split(rest, ".")
+	if len(parts) > 3 {
+		return SemVer{}, fmt.Errorf("invalid version %q", s)
+	}
+	numbers := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return SemVer{}, fmt.Errorf("invalid version %q", s)
+		}
+		*numbers[i] = n
+	}
+	return v, nil
+}
+
+func (v SemVer) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 if v is lower than, equal to or higher than other.
+// A prerelease is lower than the release it precedes; prereleases compare as strings.
+func (v SemVer) Compare(other SemVer) int {
+	for _, d := range []int{v.Major - other.Major, v.Minor - other.Minor, v.Patch - other.Patch} {
+		if d != 0 {
+			if d < 0 {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case v.Prerelease == other.Prerelease:
+		return 0
+	case v.Prerelease == "":
+		return 1
+	case other.Prerelease == "":
+		return -1
+	}
+	return strings.Compare(v.Prerelease, other.Prerelease)
+}
+
+// AtLeast reports whether v is minVersion or a later version
+func (v SemVer) AtLeast(minVersion SemVer) bool {
+	return v.Compare(minVersion) >= 0
+}
+
+// Feature is a part of the API only available from some server version on
+type Feature string
+
+const (
+	FeatureAccessKeyMethod      Feature = "access-key-method"      // method of new keys, POST /access-keys
+	FeatureAccessKeyWithID      Feature = "access-key-with-id"     // PUT /access-keys/{id} and the other key settings on creation
+	FeatureExperimentalMetrics  Feature = "experimental-metrics"   // GET /experimental/server/metrics
+	FeatureResetTransferMetrics Feature = "reset-transfer-metrics" // DELETE /metrics/transfer, only in some forks
+)
+
+// featureVersions maps every Feature to the first server version supporting it
+var featureVersions = map[Feature]SemVer{
+	FeatureAccessKeyMethod:      {Major: 1, Minor: 6},
+	FeatureAccessKeyWithID:      {Major: 1, Minor: 7},
+	FeatureExperimentalMetrics:  {Major: 1, Minor: 9},
+	FeatureResetTransferMetrics: {Major: 1, Minor: 9}, // the forks adding it are based on 1.9 or later
+}
+
+// ServerVersion returns the version of the Outline server, using the cached server info when available
+func (c *Client) ServerVersion() (SemVer, error) {
+	return c.ServerVersionCtx(context.Background())
+}
+
+func (c *Client) ServerVersionCtx(ctx context.Context) (SemVer, error) {
+	server, ok := c.CachedServerInfo()
+	if !ok {
+		var err error
+		if server, err = c.GetServerInfoCtx(ctx); err != nil {
+			return SemVer{}, err
+		}
+	}
+	return ParseSemVer(server.Version)
+}
+
+// SupportsFeature reports whether the server version is recent enough for f
+func (c *Client) SupportsFeature(f Feature) (bool, error) {
+	return c.SupportsFeatureCtx(context.Background(), f)
+}
+
+func (c *Client) SupportsFeatureCtx(ctx context.Context, f Feature) (bool, error) {
+	minVersion, ok := featureVersions[f]
+	if !ok {
+		return false, fmt.Errorf("unknown feature %q", f)
+	}
+	version, err := c.ServerVersionCtx(ctx)
+	if err != nil {
+		return false, err
+	}
+	return version.AtLeast(minVersion), nil
+}
+
+// requireFeature returns an *UnsupportedVersionError if the server is known to be too old for f.
+// Servers with an unreadable version are given the benefit of the doubt.
+func (c *Client) requireFeature(ctx context.Context, f Feature) error {
+	version, err := c.ServerVersionCtx(ctx)
+	if err != nil {
+		return nil
+	}
+	if minVersion := featureVersions[f]; !version.AtLeast(minVersion) {
+		return &UnsupportedVersionError{Feature: f, Required: minVersion, Actual: version}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package outline_lib
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseSemVer(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    SemVer
+		wantErr bool
+	}{
+		{"1.9.2", SemVer{Major: 1, Minor: 9, Patch: 2}, false},
+		{"v1.9", SemVer{Major: 1, Minor: 9}, false},
+		{"2", SemVer{Major: 2}, false},
+		{" 1.10.0-rc1+build.5 ", SemVer{Major: 1, Minor: 10, Prerelease: "rc1"}, false},
+		{"1.7.0+abc", SemVer{Major: 1, Minor: 7}, false},
+
+		{"", SemVer{}, true},
+		{"1.2.3.4", SemVer{}, true},
+		{"1.x", SemVer{}, true},
+		{"1.-2", SemVer{}, true},
+		{"unknown", SemVer{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseSemVer(tt.in)
+		if tt.wantErr != (err != nil) {
+			t.Errorf("ParseSemVer(%q): got error %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseSemVer(%q): got %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSemVerCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.9.2", "1.9.2", 0},
+		{"1.9", "1.9.0", 0},
+		{"1.10.0", "1.9.9", 1},
+		{"1.9.2", "2.0.0", -1},
+		{"1.10.0-rc1", "1.10.0", -1},
+		{"1.10.0", "1.10.0-rc1", 1},
+		{"1.10.0-rc1", "1.10.0-rc2", -1},
+		{"1.10.0-rc1", "1.9.5", 1},
+	}
+
+	for _, tt := range tests {
+		a, _ := ParseSemVer(tt.a)
+		b, _ := ParseSemVer(tt.b)
+		if got := a.Compare(b); got != tt.want {
+			t.Errorf("%s.Compare(%s): got %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := a.AtLeast(b); got != (tt.want >= 0) {
+			t.Errorf("%s.AtLeast(%s): got %v", tt.a, tt.b, got)
+		}
+	}
+}
+
+func TestResetTransferMetricsVersionGate(t *testing.T) {
+	tests := []struct {
+		version     string
+		status      int
+		wantDelete  bool
+		wantErr     error
+		wantVersion bool
+	}{
+		{"1.8.1", http.StatusNoContent, false, ErrNotSupported, true},
+		{"1.9.0", http.StatusNotFound, true, ErrNotSupported, false},
+		{"1.9.0", http.StatusNoContent, true, nil, false},
+		{"", http.StatusNoContent, true, nil, false},
+	}
+
+	for _, tt := range tests {
+		var deleted bool
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == http.MethodGet && r.URL.Path == "/server":
+				w.Write([]byte(`{"name":"test","serverId":"1","version":"` + tt.version + `"}`))
+			case r.Method == http.MethodDelete && r.URL.Path == "/metrics/transfer":
+				deleted = true
+				w.WriteHeader(tt.status)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		err := NewClient(srv.URL).ResetTransferMetrics(context.Background())
+		srv.Close()
+		if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil) != (err == nil) {
+			t.Errorf("version %q, status %d: got %v, want %v", tt.version, tt.status, err, tt.wantErr)
+		}
+		var versionErr *UnsupportedVersionError
+		if errors.As(err, &versionErr) != tt.wantVersion {
+			t.Errorf("version %q, status %d: got %v, want an *UnsupportedVersionError: %v", tt.version, tt.status, err, tt.wantVersion)
+		}
+		if deleted != tt.wantDelete {
+			t.Errorf("version %q, status %d: sent the request %v, want %v", tt.version, tt.status, deleted, tt.wantDelete)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package outline_lib
+
+import (
+	"context"
+	"sync"
+)
+
+// flightGroup runs at most one call per key at a time; concurrent callers of the same key
+// wait for it and share its result, like golang.org/x/sync/singleflight.
+// The zero value is ready to use.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	done chan struct{}
+	val  any
+	err  error
+}
+
+// do runs fn once for all concurrent callers of key. fn gets the ctx of the first caller without
+// its cancellation but with its deadline, so a caller giving up does not fail the others;
+// each caller returns when its own ctx is done.
+func (g *flightGroup) do(ctx context.Context, key string, fn func(ctx context.Context) (any, error)) (any, error) {
+	g.mu.Lock()
+	call, ok := g.calls[key]
+	if !ok {
+		if g.calls == nil {
+			g.calls = make(map[string]*flightCall)
+		}
+		call = &flightCall{done: make(chan struct{})}
+		g.calls[key] = call
+
+		callCtx, cancel := context.WithoutCancel(ctx), context.CancelFunc(func() {})
+		if deadline, ok := ctx.Deadline(); ok {
+			callCtx, cancel = context.WithDeadline(callCtx, deadline)
+		}
+		go func() {
+			defer cancel()
+			call.val, call.err = fn(callCtx)
+			g.mu.Lock()
+			delete(g.calls, key)
+			g.mu.Unlock()
+			close(call.done)
+		}()
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.val, call.err
+	case <-ctx.Done():
+		return nil, wrapContextError(ctx.Err())
+	}
+}
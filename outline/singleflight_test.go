@@ -0,0 +1,66 @@
+package outline_lib
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFlightGroupKeepsDeadline(t *testing.T) {
+	var g flightGroup
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	want, _ := ctx.Deadline()
+
+	_, err := g.do(ctx, "key", func(ctx context.Context) (any, error) {
+		if got, ok := ctx.Deadline(); !ok || !got.Equal(want) {
+			t.Errorf("shared call has deadline %v, %v, want %v", got, ok, want)
+		}
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFlightGroupWaiterReturnsOnOwnContext(t *testing.T) {
+	var g flightGroup
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+
+	go g.do(context.Background(), "key", func(ctx context.Context) (any, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := g.do(ctx, "key", nil); !errors.Is(err, ErrCanceled) {
+		t.Errorf("got %v, want ErrCanceled", err)
+	}
+}
+
+// A cached lookup must be bounded by the caller's deadline like a direct request,
+// not by Timeouts.ListKeys
+func TestCachedAccessKeysUsesCallerDeadline(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte(`{"accessKeys":[{"id":"1"}]}`))
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL)
+	c.Timeouts.ListKeys = 20 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := c.GetAccessKeyByIDCtx(ctx, "1"); err != nil {
+		t.Fatal(err)
+	}
+}
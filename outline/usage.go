@@ -0,0 +1,286 @@
+package outline_lib
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// AccessKeyUsage is an access key together with the bytes it has transferred
+type AccessKeyUsage struct {
+	AccessKey
+	BytesTransferred int64
+}
+
+// GetAccessKeysByUsage returns all access keys sorted by transferred bytes.
+// Keys without traffic are reported with zero bytes.
+func (c *Client) GetAccessKeysByUsage(desc bool) ([]AccessKeyUsage, error) {
+	return c.GetAccessKeysByUsageCtx(context.Background(), desc)
+}
+
+func (c *Client) GetAccessKeysByUsageCtx(ctx context.Context, desc bool) ([]AccessKeyUsage, error) {
+	accessKeysResponse, err := c.GetListAccessKeysCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	transferData, err := c.DataTransferredAccessKeyCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]AccessKeyUsage, 0, len(accessKeysResponse.AccessKeys))
+	for _, key := range accessKeysResponse.AccessKeys {
+		result = append(result, AccessKeyUsage{
+			AccessKey:        key,
+			BytesTransferred: transferData.BytesTransferredByUserId[key.Id],
+		})
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		if desc {
+			return result[i].BytesTransferred > result[j].BytesTransferred
+		}
+		return result[i].BytesTransferred < result[j].BytesTransferred
+	})
+	return result, nil
+}
+
+// UsageReport is the usage of a key compared to its data limit
+type UsageReport struct {
+	Id         string
+	Name       string
+	UsedBytes  int64
+	LimitBytes *int64 // nil if the key has no data limit
+	// PercentUsed is UsedBytes relative to LimitBytes and exceeds 100 for keys over their limit.
+	// It is 0 for keys without a limit and 100 for keys with a zero limit.
+	PercentUsed float64
+}
+
+// GetAccessKeyUsageReport returns the usage and data limit of every access key
+func (c *Client) GetAccessKeyUsageReport() ([]UsageReport, error) {
+	return c.GetAccessKeyUsageReportCtx(context.Background())
+}
+
+func (c *Client) GetAccessKeyUsageReportCtx(ctx context.Context) ([]UsageReport, error) {
+	usages, err := c.GetAccessKeysByUsageCtx(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make([]UsageReport, 0, len(usages))
+	for _, usage := range usages {
+		reports = append(reports, newUsageReport(usage))
+	}
+	return reports, nil
+}
+
+// WriteUsageCSV writes the usage report of every access key to w as CSV, with a header row.
+// The limit and percent columns are empty for keys without a data limit.
+func (c *Client) WriteUsageCSV(w io.Writer) error {
+	return c.WriteUsageCSVCtx(context.Background(), w)
+}
+
+func (c *Client) WriteUsageCSVCtx(ctx context.Context, w io.Writer) error {
+	reports, err := c.GetAccessKeyUsageReportCtx(ctx)
+	if err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"id", "name", "bytes_transferred", "limit_bytes", "percent_used"}); err != nil {
+		return err
+	}
+	for _, report := range reports {
+		limit, percent := "", ""
+		if report.LimitBytes != nil {
+			limit = strconv.FormatInt(*report.LimitBytes, 10)
+			percent = strconv.FormatFloat(report.PercentUsed, 'f', 2, 64)
+		}
+		row := []string{report.Id, report.Name, strconv.FormatInt(report.UsedBytes, 10), limit, percent}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func newUsageReport(usage AccessKeyUsage) UsageReport {
+	report := UsageReport{
+		Id:        usage.Id,
+		Name:      usage.Name,
+		UsedBytes: usage.BytesTransferred,
+	}
+	if usage.DataLimit == nil {
+		return report
+	}
+
+	limit := usage.DataLimit.Bytes
+	report.LimitBytes = &limit
+	if limit > 0 {
+		report.PercentUsed = float64(usage.BytesTransferred) / float64(limit) * 100
+	} else {
+		report.PercentUsed = 100
+	}
+	return report
+}
+
+// KeysOverLimit returns the keys whose transferred bytes exceed their own data limit.
+// Keys without a limit of their own are not included.
+func (c *Client) KeysOverLimit() ([]AccessKey, error) {
+	return c.KeysOverLimitCtx(context.Background())
+}
+
+func (c *Client) KeysOverLimitCtx(ctx context.Context) ([]AccessKey, error) {
+	accessKeysResponse, err := c.GetListAccessKeysCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	transferData, err := c.DataTransferredAccessKeyCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []AccessKey
+	for _, key := range accessKeysResponse.AccessKeys {
+		if key.DataLimit != nil && transferData.BytesTransferredByUserId[key.Id] > key.DataLimit.Bytes {
+			result = append(result, key)
+		}
+	}
+	return result, nil
+}
+
+// KeysWithoutLimit returns the keys that can transfer unlimited data: those without a data limit
+// of their own, unless the server-wide limit applies to them
+func (c *Client) KeysWithoutLimit() ([]AccessKey, error) {
+	return c.KeysWithoutLimitCtx(context.Background())
+}
+
+func (c *Client) KeysWithoutLimitCtx(ctx context.Context) ([]AccessKey, error) {
+	server, err := c.GetServerInfoCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if server.AccessKeyDataLimit != nil {
+		return nil, nil
+	}
+
+	accessKeysResponse, err := c.GetListAccessKeysCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return withoutOwnLimit(accessKeysResponse.AccessKeys), nil
+}
+
+func withoutOwnLimit(keys []AccessKey) []AccessKey {
+	var result []AccessKey
+	for _, key := range keys {
+		if key.DataLimit == nil {
+			result = append(result, key)
+		}
+	}
+	return result
+}
+
+// SumTransferredBytes returns the total bytes transferred by all access keys
+func (c *Client) SumTransferredBytes() (int64, error) {
+	return c.SumTransferredBytesCtx(context.Background())
+}
+
+func (c *Client) SumTransferredBytesCtx(ctx context.Context) (int64, error) {
+	transferData, err := c.DataTransferredAccessKeyCtx(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return sumBytes(transferData.BytesTransferredByUserId), nil
+}
+
+// AverageBytesPerActiveUser returns the mean bytes transferred by the keys present
+// in the transfer metrics, or 0 if there are none
+func (c *Client) AverageBytesPerActiveUser() (float64, error) {
+	return c.AverageBytesPerActiveUserCtx(context.Background())
+}
+
+func (c *Client) AverageBytesPerActiveUserCtx(ctx context.Context) (float64, error) {
+	transferData, err := c.DataTransferredAccessKeyCtx(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if len(transferData.BytesTransferredByUserId) == 0 {
+		return 0, nil
+	}
+	return float64(sumBytes(transferData.BytesTransferredByUserId)) / float64(len(transferData.BytesTransferredByUserId)), nil
+}
+
+// TrafficShares returns the fraction, between 0 and 1, of all transferred bytes each key accounts for.
+// The result is empty if no traffic was transferred.
+func (c *Client) TrafficShares() (map[string]float64, error) {
+	return c.TrafficSharesCtx(context.Background())
+}
+
+func (c *Client) TrafficSharesCtx(ctx context.Context) (map[string]float64, error) {
+	transferData, err := c.DataTransferredAccessKeyCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	shares := make(map[string]float64, len(transferData.BytesTransferredByUserId))
+	total := sumBytes(transferData.BytesTransferredByUserId)
+	if total <= 0 {
+		return shares, nil
+	}
+	for id, bytes := range transferData.BytesTransferredByUserId {
+		shares[id] = float64(bytes) / float64(total)
+	}
+	return shares, nil
+}
+
+// UsageSnapshot is the cumulative transfer metrics of all access keys at a point in time
+type UsageSnapshot struct {
+	TakenAt          time.Time
+	BytesTransferred map[string]int64 // by access key id
+}
+
+// Snapshot records the current transfer metrics, to be compared to a later snapshot with DiffSnapshots
+func (c *Client) Snapshot() (UsageSnapshot, error) {
+	return c.SnapshotCtx(context.Background())
+}
+
+func (c *Client) SnapshotCtx(ctx context.Context) (UsageSnapshot, error) {
+	transferData, err := c.DataTransferredAccessKeyCtx(ctx)
+	if err != nil {
+		return UsageSnapshot{}, err
+	}
+	return UsageSnapshot{
+		TakenAt:          time.Now(),
+		BytesTransferred: transferData.BytesTransferredByUserId,
+	}, nil
+}
+
+// DiffSnapshots returns the bytes each key transferred between prev and curr.
+// A key whose counter is lower in curr was reset or re-created in between, so all its bytes in curr count as new;
+// keys missing from curr are left out.
+func DiffSnapshots(prev, curr UsageSnapshot) map[string]int64 {
+	deltas := make(map[string]int64, len(curr.BytesTransferred))
+	for id, bytes := range curr.BytesTransferred {
+		delta := bytes - prev.BytesTransferred[id]
+		if delta < 0 {
+			delta = bytes
+		}
+		deltas[id] = delta
+	}
+	return deltas
+}
+
+func sumBytes(bytesByKey map[string]int64) int64 {
+	var total int64
+	for _, bytes := range bytesByKey {
+		total += bytes
+	}
+	return total
+}